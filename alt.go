@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html"
+	"os"
+	"strings"
+)
+
+// suggestAlt asks -alt-cmd to describe the first frame of the output when no
+// -alt text was given. The command gets the frame as a PNG in GIFV_FILE and
+// prints the description, e.g. by posting it to an image captioning service.
+func (c *converter) suggestAlt() error {
+	if c.alt != "" || c.altCmd == "" {
+		return nil
+	}
+
+	frame := c.tempPath(tempFileName + c.suffix() + "-alt.png")
+	err := runFFmpeg("alt", 0, []string{"-y", "-i", c.outputs()[0].outputImage, "-frames:v", "1", frame})
+	if err != nil {
+		return err
+	}
+	defer os.Remove(frame)
+
+	act := beginStage("alt")
+	defer act.end()
+
+	cmd := shellCommand(c.altCmd)
+	cmd.Env = c.hookEnv("alt", frame, "")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err = cmd.Run()
+	if err != nil {
+		return errors.New(fmt.Sprint("alt command failed: ", err, ": ", strings.TrimSpace(stderr.String())))
+	}
+
+	c.alt = strings.Join(strings.Fields(stdout.String()), " ")
+	stage("alt", c.alt)
+	for _, v := range c.variants {
+		v.alt = c.alt
+	}
+
+	return nil
+}
+
+// markdownAlt escapes the alt text for a Markdown image
+func (c *converter) markdownAlt() string {
+	return strings.NewReplacer(`\`, `\\`, "[", `\[`, "]", `\]`, "\n", " ").Replace(c.alt)
+}
+
+// htmlAlt returns the alt attribute of an img tag, which is present but
+// empty without alt text
+func (c *converter) htmlAlt() string {
+	return ` alt="` + html.EscapeString(c.alt) + `"`
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"os"
+	"sort"
+	"time"
+)
+
+// largestFrames is the number of frames listed by size in the analysis
+const largestFrames = 5
+
+// gifLayout is the block structure of a GIF file, which image/gif does not
+// expose
+type gifLayout struct {
+	globalColors int
+	frames       []gifFrameInfo
+}
+
+// gifFrameInfo describes one frame of a GIF
+type gifFrameInfo struct {
+	// bytes counts the extensions, image descriptor, local color table and
+	// image data of the frame
+	bytes       int64
+	localColors int
+	usedColors  int
+	duplicate   bool
+	bounds      image.Rectangle
+}
+
+// analyzeCommand explains what a GIF spends its bytes on, to guide the
+// choice of conversion options
+func analyzeCommand(args []string) error {
+	if len(args) != 1 {
+		return errors.New("Usage: go-gif-pr analyze <file.gif>")
+	}
+
+	data, err := os.ReadFile(args[0])
+	if err != nil {
+		return err
+	}
+
+	layout, err := scanGIF(data)
+	if err != nil {
+		return err
+	}
+	g, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	if len(layout.frames) != len(g.Image) {
+		return errors.New("Could not match the frames of " + args[0])
+	}
+	frames := layout.frames
+	markFrames(g, frames)
+
+	var duration time.Duration
+	duplicates, localPalettes, maxColors := 0, 0, 0
+	palettes := map[uint64]bool{}
+	for i, f := range frames {
+		duration += time.Duration(g.Delay[i]) * 10 * time.Millisecond
+		if f.duplicate {
+			duplicates++
+		}
+		if f.localColors > 0 {
+			localPalettes++
+			palettes[paletteHash(g.Image[i].Palette)] = true
+		}
+		maxColors = max(maxColors, f.usedColors)
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	fmt.Fprintf(w, "%s: %dKB, %dx%d, %d frames, %s\n", args[0], len(data)>>10, g.Config.Width, g.Config.Height, len(frames), formatClock(duration))
+	fmt.Fprintf(w, "Global palette:   %d colors\n", layout.globalColors)
+	fmt.Fprintf(w, "Local palettes:   %d frames, %d distinct\n", localPalettes, len(palettes))
+	fmt.Fprintf(w, "Colors used:      up to %d in a frame\n", maxColors)
+	fmt.Fprintf(w, "Duplicate frames: %d\n", duplicates)
+
+	order := make([]int, len(frames))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return frames[order[a]].bytes > frames[order[b]].bytes
+	})
+	fmt.Fprintln(w, "Largest frames:")
+	for _, i := range order[:min(largestFrames, len(order))] {
+		f := frames[i]
+		fmt.Fprintf(w, "  #%-5d %6dKB  %dx%d, %d colors\n", i, f.bytes>>10, f.bounds.Dx(), f.bounds.Dy(), f.usedColors)
+	}
+
+	var hints []string
+	if g.Config.Width > 800 {
+		hints = append(hints, "the GIF is wider than most pages show it, try a smaller -w")
+	}
+	if duplicates > len(frames)/10 {
+		hints = append(hints, "many frames repeat the previous one, which -frame-delay can replace with a longer delay")
+	}
+	if len(palettes) > 1 {
+		hints = append(hints, "frames use different palettes, -shared-palette keeps a single one")
+	}
+	if duration > 15*time.Second {
+		hints = append(hints, "long GIFs are better as video, see -format mp4 or -fallback")
+	}
+	for _, hint := range hints {
+		fmt.Fprintln(w, "Hint: "+hint)
+	}
+
+	return w.Flush()
+}
+
+// scanGIF walks the blocks of a GIF, attributing the extensions before each
+// image to its frame
+func scanGIF(data []byte) (*gifLayout, error) {
+	invalid := errors.New("Not a valid GIF file")
+	if len(data) < 13 || string(data[:3]) != "GIF" {
+		return nil, invalid
+	}
+
+	layout := &gifLayout{}
+	pos := 13
+	if flags := data[10]; flags&0x80 != 0 {
+		layout.globalColors = 1 << (flags&0x07 + 1)
+		pos += 3 * layout.globalColors
+	}
+
+	// skipSubBlocks returns the position after a sequence of data sub-blocks
+	skipSubBlocks := func(pos int) int {
+		for pos < len(data) && data[pos] != 0 {
+			pos += int(data[pos]) + 1
+		}
+		return pos + 1
+	}
+
+	start := pos
+	for pos < len(data) {
+		switch data[pos] {
+		case 0x21:
+			// Extensions are a label followed by sub-blocks
+			pos = skipSubBlocks(pos + 2)
+		case 0x2c:
+			if pos+10 > len(data) {
+				return nil, invalid
+			}
+			frame := gifFrameInfo{}
+			flags := data[pos+9]
+			pos += 10
+			if flags&0x80 != 0 {
+				frame.localColors = 1 << (flags&0x07 + 1)
+				pos += 3 * frame.localColors
+			}
+			// The LZW minimum code size precedes the image data
+			pos = skipSubBlocks(pos + 1)
+			frame.bytes = int64(min(pos, len(data)) - start)
+			layout.frames = append(layout.frames, frame)
+			start = pos
+		case 0x3b:
+			return layout, nil
+		default:
+			return nil, invalid
+		}
+	}
+
+	// Truncated files are still worth explaining
+	return layout, nil
+}
+
+// markFrames fills in the colors used by each frame and whether it leaves
+// the canvas unchanged, composing the frames as a viewer would
+func markFrames(g *gif.GIF, frames []gifFrameInfo) {
+	canvas := image.NewRGBA(image.Rect(0, 0, g.Config.Width, g.Config.Height))
+	var previous uint64
+	for i, img := range g.Image {
+		frames[i].bounds = img.Bounds()
+
+		used := map[uint8]bool{}
+		for _, p := range img.Pix {
+			used[p] = true
+		}
+		frames[i].usedColors = len(used)
+
+		var saved *image.RGBA
+		disposal := byte(gif.DisposalNone)
+		if i < len(g.Disposal) {
+			disposal = g.Disposal[i]
+		}
+		if disposal == gif.DisposalPrevious {
+			saved = image.NewRGBA(canvas.Bounds())
+			copy(saved.Pix, canvas.Pix)
+		}
+
+		draw.Draw(canvas, img.Bounds(), img, img.Bounds().Min, draw.Over)
+		h := fnv.New64a()
+		h.Write(canvas.Pix)
+		sum := h.Sum64()
+		frames[i].duplicate = i > 0 && sum == previous
+		previous = sum
+
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, img.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			canvas = saved
+		}
+	}
+}
+
+func paletteHash(p color.Palette) uint64 {
+	h := fnv.New64a()
+	for _, c := range p {
+		r, g, b, a := c.RGBA()
+		h.Write([]byte{byte(r >> 8), byte(g >> 8), byte(b >> 8), byte(a >> 8)})
+	}
+
+	return h.Sum64()
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+type manifestEntry struct {
+	Source string `json:"source"`
+	File   string `json:"file"`
+	URL    string `json:"url,omitempty"`
+}
+
+const manifestFileName = "manifest.json"
+
+// writeArchive bundles the outputs of the converted jobs together with a
+// manifest of their sources and uploaded URLs into a single zip file.
+func writeArchive(archivePath string, jobs []*converter) error {
+	out, err := os.Create(archivePath)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	zw := zip.NewWriter(out)
+
+	var manifest []manifestEntry
+	names := entryNames{manifestFileName: true}
+	for _, c := range jobs {
+		name := names.add(c.outputImage)
+		err = addToArchive(zw, name, c.outputImage)
+		if err != nil {
+			return err
+		}
+
+		entry := manifestEntry{Source: c.startImage, File: name}
+		if c.uploaded() {
+			entry.URL = c.endImage
+		}
+		manifest = append(manifest, entry)
+	}
+
+	mw, err := zw.Create(manifestFileName)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(mw)
+	enc.SetIndent("", "  ")
+	err = enc.Encode(manifest)
+	if err != nil {
+		return err
+	}
+
+	err = zw.Close()
+	if err != nil {
+		return err
+	}
+
+	return out.Close()
+}
+
+func addToArchive(zw *zip.Writer, name, file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// GIFs are already compressed, so store them as is
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// entryNames hands out the names of files put side by side in an archive or
+// gallery. Outputs of different directories may share a name, so a repeated
+// one gets the next free number, e.g. demo-2.gif. Names are compared without
+// case for case-insensitive file systems.
+type entryNames map[string]bool
+
+func (n entryNames) add(file string) string {
+	base := filepath.Base(file)
+	ext := filepath.Ext(base)
+	name := base
+	for i := 2; n[strings.ToLower(name)]; i++ {
+		name = strings.TrimSuffix(base, ext) + "-" + strconv.Itoa(i) + ext
+	}
+	n[strings.ToLower(name)] = true
+
+	return name
+}
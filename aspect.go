@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseAspect parses a ratio such as 16:9
+func parseAspect(aspect string) (int, int, error) {
+	w, h, ok := strings.Cut(aspect, ":")
+	width, err1 := strconv.Atoi(strings.TrimSpace(w))
+	height, err2 := strconv.Atoi(strings.TrimSpace(h))
+	if !ok || err1 != nil || err2 != nil || width <= 0 || height <= 0 {
+		return 0, 0, errors.New("Aspect must be given as W:H, e.g. 1:1, 9:16 or 16:9")
+	}
+
+	return width, height, nil
+}
+
+func (c *converter) validateAspect() error {
+	if c.aspect == "" {
+		return nil
+	}
+	if _, _, err := parseAspect(c.aspect); err != nil {
+		return err
+	}
+
+	switch c.gravity {
+	case "center", "north", "south", "east", "west":
+	default:
+		return errors.New("Gravity must be center, north, south, east or west")
+	}
+	switch c.aspectFit {
+	case "crop", "pad":
+	default:
+		return errors.New("-aspect-fit must be crop or pad")
+	}
+
+	return nil
+}
+
+// aspectFilter crops the frames to the aspect ratio, keeping the part given
+// by the gravity, or pads them with black bars when fitting by padding
+func (c *converter) aspectFilter() string {
+	if c.aspect == "" {
+		return ""
+	}
+
+	w, h, _ := parseAspect(c.aspect)
+	ratio := fmt.Sprintf("%d/%d", w, h)
+
+	// The free space is the part cropped off, or the border added by padding
+	freeX, freeY := "iw-ow", "ih-oh"
+	if c.aspectFit == "pad" {
+		freeX, freeY = "ow-iw", "oh-ih"
+	}
+	x, y := "("+freeX+")/2", "("+freeY+")/2"
+	switch c.gravity {
+	case "north":
+		y = "0"
+	case "south":
+		y = freeY
+	case "west":
+		x = "0"
+	case "east":
+		x = freeX
+	}
+
+	if c.aspectFit == "pad" {
+		return "pad=w='max(iw,ih*" + ratio + ")':h='max(ih,iw/" + ratio + ")':x='" + x + "':y='" + y + "':color=black"
+	}
+
+	return "crop=w='min(iw,ih*" + ratio + ")':h='min(ih,iw/" + ratio + ")':x='" + x + "':y='" + y + "'"
+}
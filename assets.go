@@ -0,0 +1,221 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Files kept in the assets directory. The state records what each source
+// was converted from so unchanged files are skipped on the next run, the map
+// lists the URL of every source for use in templates.
+const (
+	assetsStateFile = ".gifv-state.json"
+	assetsMapFile   = "gifv-assets.json"
+)
+
+// Extensions of the media files picked up from an assets directory
+var assetExtensions = map[string]bool{
+	".mp4": true, ".mov": true, ".m4v": true, ".webm": true, ".mkv": true,
+	".avi": true, ".gifv": true, ".gif": true,
+}
+
+type assetState struct {
+	SHA256  string    `json:"sha256"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	Output  string    `json:"output"`
+	URL     string    `json:"url"`
+}
+
+// assetsDir tracks the sources of an assets directory between runs
+type assetsDir struct {
+	dir     string
+	state   map[string]*assetState
+	pending map[*converter]*assetState
+	sources map[*converter]string
+}
+
+// loadAssets scans dir for media files and returns a job for every file
+// that is new or changed since the last run
+func loadAssets(dir string, defaults *converter) ([]*converter, *assetsDir, error) {
+	// The state and map keep one output and URL per source
+	if defaults.widthList != "" {
+		return nil, nil, errors.New("-assets-dir keeps one URL per source and cannot be combined with -widths, use -w")
+	}
+	assets := &assetsDir{
+		dir:     dir,
+		state:   make(map[string]*assetState),
+		pending: make(map[*converter]*assetState),
+		sources: make(map[*converter]string),
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, assetsStateFile))
+	if err == nil {
+		err = json.Unmarshal(data, &assets.state)
+		if err != nil {
+			return nil, nil, errors.New(assetsStateFile + ": " + err.Error())
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, nil, err
+	}
+
+	// Outputs written into the directory are not sources, and their names
+	// are not given to new ones
+	outputs := make(map[string]bool)
+	names := make(map[string]bool)
+	for _, s := range assets.state {
+		if abs, err := filepath.Abs(s.Output); err == nil {
+			outputs[abs] = true
+		}
+		base := filepath.Base(s.Output)
+		names[strings.ToLower(strings.TrimSuffix(base, filepath.Ext(base)))] = true
+	}
+
+	var jobs []*converter
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !assetExtensions[strings.ToLower(filepath.Ext(path))] {
+			return nil
+		}
+		if abs, err := filepath.Abs(path); err == nil && outputs[abs] {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		current := &assetState{Size: info.Size(), ModTime: info.ModTime()}
+		previous := assets.state[rel]
+		// Only hash files whose size or modification time changed
+		if previous != nil && previous.Size == current.Size && previous.ModTime.Equal(current.ModTime) {
+			return nil
+		}
+		current.SHA256, err = hashFile(path)
+		if err != nil {
+			return err
+		}
+		if previous != nil && previous.SHA256 == current.SHA256 {
+			previous.Size, previous.ModTime = current.Size, current.ModTime
+			return nil
+		}
+
+		job := *defaults
+		job.startImage = path
+		// Name outputs after their source rather than output-N
+		if job.nameTemplate == "" {
+			job.keepName = true
+			job.assetName = assetOutputName(rel, previous, names)
+		}
+		err = job.validate()
+		if err != nil {
+			return errors.New(rel + ": " + err.Error())
+		}
+		jobs = append(jobs, &job)
+		assets.pending[&job] = current
+		assets.sources[&job] = rel
+
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return jobs, assets, nil
+}
+
+// assetOutputName names the output of a source after its path in the
+// directory, so clips/intro.mp4 becomes clips-intro. A changed source keeps
+// the name of its previous output. Names already taken, by another source
+// or another extension of the same one, get a number: intro-2.
+func assetOutputName(rel string, previous *assetState, names map[string]bool) string {
+	if previous != nil && previous.Output != "" {
+		base := filepath.Base(previous.Output)
+		return strings.TrimSuffix(base, filepath.Ext(base))
+	}
+
+	base := sanitizeName(strings.ReplaceAll(strings.TrimSuffix(rel, path.Ext(rel)), "/", "-"))
+	name := base
+	for i := 2; names[strings.ToLower(name)]; i++ {
+		name = base + "-" + strconv.Itoa(i)
+	}
+	names[strings.ToLower(name)] = true
+
+	return name
+}
+
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	_, err = io.Copy(h, f)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// save records the converted jobs in the state file and rewrites the map of
+// every source to its URL. Failed jobs are left out so they are retried.
+func (a *assetsDir) save(jobs []*converter) error {
+	for _, c := range jobs {
+		current := a.pending[c]
+		if current == nil || c.err != nil {
+			continue
+		}
+		current.Output = c.outputImage
+		current.URL = c.endImage
+		a.state[a.sources[c]] = current
+	}
+
+	// Forget sources that were removed from the directory
+	for rel := range a.state {
+		if _, err := os.Stat(filepath.Join(a.dir, filepath.FromSlash(rel))); os.IsNotExist(err) {
+			delete(a.state, rel)
+		}
+	}
+
+	err := writeJSON(filepath.Join(a.dir, assetsStateFile), a.state)
+	if err != nil {
+		return err
+	}
+
+	urls := make(map[string]string)
+	for rel, s := range a.state {
+		urls[rel] = s.URL
+	}
+
+	return writeJSON(filepath.Join(a.dir, assetsMapFile), urls)
+}
+
+func writeJSON(path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
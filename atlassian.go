@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const keyringAtlassianToken = "atlassian-token"
+
+type jiraAttachment struct {
+	Content string `json:"content"`
+}
+
+type confluenceAttachments struct {
+	Results []struct {
+		Links struct {
+			Download string `json:"download"`
+		} `json:"_links"`
+	} `json:"results"`
+	Links struct {
+		Base string `json:"base"`
+	} `json:"_links"`
+}
+
+// uploadJira attaches the output to the issue given by -jira-issue
+func (c *converter) uploadJira() error {
+	target := strings.TrimRight(c.atlassianURL, "/") + "/rest/api/2/issue/" + url.PathEscape(c.jiraIssue) + "/attachments"
+
+	data, err := os.ReadFile(c.outputImage)
+	if err != nil {
+		return err
+	}
+	// Jira keeps every attachment, even under a name it already has
+	var attachments []jiraAttachment
+	err = c.postAttachment("POST", target, filepath.Base(c.outputImage), data, &attachments)
+	if err != nil {
+		return err
+	}
+	if len(attachments) == 0 {
+		return errors.New("Jira error: no attachment returned")
+	}
+
+	c.endImage = attachments[0].Content
+	return nil
+}
+
+// uploadConfluence attaches the output to the page given by -confluence-page.
+// Pages hold one attachment per name, so default names get a hash of the
+// content, and a PUT adds a new version of an attachment named on purpose.
+func (c *converter) uploadConfluence() error {
+	target := strings.TrimRight(c.atlassianURL, "/") + "/rest/api/content/" + url.PathEscape(c.confluencePage) + "/child/attachment"
+
+	data, err := os.ReadFile(c.outputImage)
+	if err != nil {
+		return err
+	}
+	var attachments confluenceAttachments
+	err = c.postAttachment("PUT", target, c.uploadName(data), data, &attachments)
+	if err != nil {
+		return err
+	}
+	if len(attachments.Results) == 0 {
+		return errors.New("Confluence error: no attachment returned")
+	}
+
+	c.endImage = attachments.Links.Base + attachments.Results[0].Links.Download
+	return nil
+}
+
+// postAttachment uploads the output as a multipart "file" field named name,
+// which both the Jira and Confluence REST APIs accept, and decodes the
+// response into v
+func (c *converter) postAttachment(method, target, name string, data []byte, v interface{}) error {
+	if strings.TrimSpace(c.atlassianToken) == "" {
+		return errors.New("An Atlassian API token is required, set ATLASSIAN_API_TOKEN or run: go-gif-pr auth set " + keyringAtlassianToken)
+	}
+
+	var b bytes.Buffer
+	w := multipart.NewWriter(&b)
+	fw, err := w.CreateFormFile("file", name)
+	if err != nil {
+		return err
+	}
+	if _, err = fw.Write(data); err != nil {
+		return err
+	}
+	w.Close()
+
+	req, err := http.NewRequestWithContext(shutdownCtx, method, target, c.throttle(&b))
+	if err != nil {
+		return err
+	}
+	req.ContentLength = int64(b.Len())
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	req.Header.Set("X-Atlassian-Token", "no-check")
+	req.SetBasicAuth(c.atlassianUser, c.atlassianToken)
+
+	client := &http.Client{
+		Timeout: c.timeout,
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errors.New("Atlassian error: " + resp.Status)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// wikiMarkup returns the Jira/Confluence markup embedding the attachment,
+// by the name it was attached under, the last element of its URL
+func (c *converter) wikiMarkup() string {
+	name := filepath.Base(c.outputImage)
+	if u, err := url.Parse(c.endImage); err == nil && c.endImage != "" {
+		if attached, err := url.PathUnescape(path.Base(u.Path)); err == nil && attached != "." && attached != "/" {
+			name = attached
+		}
+	}
+
+	return "!" + name + "!"
+}
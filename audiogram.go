@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// Size and frame rate of the video rendered from audio sources. Outputs are
+// scaled down from it like any other video.
+const (
+	audiogramWidth  = 1280
+	audiogramHeight = 720
+	audiogramRate   = 15
+)
+
+func (c *converter) validateAudiogram() error {
+	switch c.audiogram {
+	case "waves", "spectrum":
+	default:
+		return errors.New("Audiogram must be waves or spectrum")
+	}
+
+	if c.background != "" {
+		if _, err := os.Stat(c.background); err != nil {
+			return errors.New("Background image does not exist: " + c.background)
+		}
+	}
+
+	return nil
+}
+
+// renderAudiogram turns an audio source into a waveform or spectrogram
+// video, which then replaces the source for the rest of the conversion
+func (c *converter) renderAudiogram() error {
+	width, height := audiogramWidth, audiogramHeight
+	if c.background != "" {
+		// Leave the upper part of the background visible
+		height = audiogramHeight / 3
+	}
+
+	var graph string
+	switch c.audiogram {
+	case "spectrum":
+		graph = fmt.Sprintf("[0:a]showspectrum=s=%dx%d:slide=scroll:mode=combined:color=intensity,fps=%d,format=yuv420p", width, height, audiogramRate)
+	default:
+		graph = fmt.Sprintf("[0:a]showwaves=s=%dx%d:mode=cline:rate=%d:colors=%s", width, height, audiogramRate, c.waveColor)
+	}
+	args := c.inputArgs()
+	if c.background != "" {
+		graph += fmt.Sprintf("[wave];[1:v]scale=%d:%d:force_original_aspect_ratio=increase,crop=%d:%d[bg];[bg][wave]overlay=0:H-h:shortest=1,format=yuv420p",
+			audiogramWidth, audiogramHeight, audiogramWidth, audiogramHeight)
+		args = append(args, "-loop", "1", "-i", c.background)
+	} else if c.audiogram != "spectrum" {
+		graph += ",format=yuv420p"
+	}
+	graph += "[v]"
+
+	rendered := c.tempPath(tempFileName + c.suffix() + "-audiogram.mkv")
+	args = append(args, "-y", "-filter_complex", graph, "-map", "[v]", "-map", "0:a", "-c:v", "libx264", "-preset", "ultrafast", "-c:a", "aac", rendered)
+	err := runFFmpeg("audiogram", c.expectedDuration(), args)
+	if err != nil {
+		return err
+	}
+
+	// The downloaded source is no longer needed
+	if c.startImage != c.fileToConvert && !c.keepFiles && !c.keepSource {
+		os.Remove(c.fileToConvert)
+	}
+	c.fileToConvert = rendered
+	// The rendered clip only covers the trimmed part already
+	c.trim = ""
+
+	info, err := probe(shutdownCtx, rendered)
+	if err != nil {
+		return err
+	}
+	info.Title = c.meta.Title
+	info.CreationTime = c.meta.CreationTime
+	c.meta = info
+
+	return nil
+}
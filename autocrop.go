@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+)
+
+// Motion is detected on small grayscale frames sampled at this rate, where a
+// pixel counts as changed when it differs by more than motionThreshold
+const (
+	motionWidth     = 160
+	motionRate      = 5
+	motionThreshold = 24
+)
+
+// cropRegion is an area of the upright source frames
+type cropRegion struct {
+	x, y, width, height int
+}
+
+func (r *cropRegion) String() string {
+	return fmt.Sprintf("%dx%d+%d+%d", r.width, r.height, r.x, r.y)
+}
+
+func (r *cropRegion) filter() string {
+	return fmt.Sprintf("crop=%d:%d:%d:%d", r.width, r.height, r.x, r.y)
+}
+
+// detectMotion finds the bounding box of everything that changes during the
+// clip, so static margins such as the desktop around a dialog can be cut
+func (c *converter) detectMotion() (*cropRegion, error) {
+	width, height := c.displaySize()
+	if width == 0 || height == 0 {
+		return nil, errors.New("-auto-crop needs a source with a known size")
+	}
+	sampleHeight := motionWidth * height / width
+	if sampleHeight < 1 {
+		sampleHeight = 1
+	}
+
+	filters := append(c.frameFilters(), c.rotationFilters()...)
+	filters = append(filters, fmt.Sprintf("fps=%d", motionRate), fmt.Sprintf("scale=%d:%d", motionWidth, sampleHeight), "format=gray")
+	args := append(c.inputArgs(), "-vf", strings.Join(filters, ","), "-an", "-f", "rawvideo", "pipe:1")
+
+	act := beginStage("analyze")
+	defer act.end()
+
+	cmd := exec.CommandContext(shutdownCtx, "ffmpeg", append(threadArgs(), args...)...)
+	var ffmpegErr bytes.Buffer
+	cmd.Stderr = &ffmpegErr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	err = cmd.Start()
+	if err != nil {
+		return nil, err
+	}
+
+	minX, minY, maxX, maxY := motionWidth, sampleHeight, -1, -1
+	frame := make([]byte, motionWidth*sampleHeight)
+	var previous []byte
+	r := bufio.NewReader(stdout)
+	for {
+		_, err = io.ReadFull(r, frame)
+		if err != nil {
+			break
+		}
+		if previous != nil {
+			for i := range frame {
+				diff := int(frame[i]) - int(previous[i])
+				if diff > motionThreshold || diff < -motionThreshold {
+					x, y := i%motionWidth, i/motionWidth
+					minX, maxX = min(minX, x), max(maxX, x)
+					minY, maxY = min(minY, y), max(maxY, y)
+				}
+			}
+		} else {
+			previous = make([]byte, len(frame))
+		}
+		copy(previous, frame)
+	}
+
+	err = cmd.Wait()
+	if err != nil {
+		return nil, errors.New(fmt.Sprint(err) + ": " + ffmpegErr.String())
+	}
+	if maxX < 0 {
+		return nil, errors.New("No motion detected for -auto-crop")
+	}
+
+	// Scale the box back to the source, widened by one sample on each side
+	// to make up for the coarse sampling
+	region := &cropRegion{
+		x:      (minX - 1) * width / motionWidth,
+		y:      (minY - 1) * height / sampleHeight,
+		width:  (maxX + 2) * width / motionWidth,
+		height: (maxY + 2) * height / sampleHeight,
+	}
+	region.x, region.y = max(region.x, 0), max(region.y, 0)
+	region.width, region.height = min(region.width, width)-region.x, min(region.height, height)-region.y
+	// Keep the sides even for the video encoders
+	region.width -= region.width % 2
+	region.height -= region.height % 2
+
+	return region, nil
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	downloadCacheDirName = "downloads"
+	// The least recently used downloads are removed past this size
+	downloadCacheLimit = 2 << 30
+)
+
+// cachedDownload describes a download kept in the cache directory, with
+// the validators the server sent for it
+type cachedDownload struct {
+	URL          string    `json:"url"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	Fetched      time.Time `json:"fetched"`
+
+	data string
+}
+
+// downloadCacheFile returns the path of the cached download of a URL,
+// without extension: .data holds the download and .json its validators
+func downloadCacheFile(src string) (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(src))
+
+	return filepath.Join(dir, keyringService, downloadCacheDirName, hex.EncodeToString(sum[:16])), nil
+}
+
+// revalidate makes req conditional on the cached download of its URL and
+// returns that download, or nil when there is none
+func (c *converter) revalidate(req *http.Request) *cachedDownload {
+	if c.noCache {
+		return nil
+	}
+	base, err := downloadCacheFile(req.URL.String())
+	if err != nil {
+		return nil
+	}
+	data, err := os.ReadFile(base + ".json")
+	if err != nil {
+		return nil
+	}
+	var cached cachedDownload
+	if json.Unmarshal(data, &cached) != nil || cached.URL != req.URL.String() {
+		return nil
+	}
+	cached.data = base + ".data"
+	if _, err := os.Stat(cached.data); err != nil {
+		return nil
+	}
+
+	if cached.ETag != "" {
+		req.Header.Set("If-None-Match", cached.ETag)
+	}
+	if cached.LastModified != "" {
+		req.Header.Set("If-Modified-Since", cached.LastModified)
+	}
+
+	return &cached
+}
+
+// copyTo writes the cached download to w and marks it as recently used
+func (d *cachedDownload) copyTo(w io.Writer) error {
+	f, err := os.Open(d.data)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	os.Chtimes(d.data, now, now)
+
+	return nil
+}
+
+// cacheDownload keeps a copy of a download whose response can be
+// revalidated, then trims the cache to downloadCacheLimit
+func cacheDownload(src string, resp *http.Response, file string) error {
+	etag, modified := resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+	if resp.StatusCode != http.StatusOK || etag == "" && modified == "" {
+		return nil
+	}
+	base, err := downloadCacheFile(src)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(base), 0700)
+	if err != nil {
+		return err
+	}
+
+	// Copied under a temporary name so a concurrent run never reads half
+	temp := base + ".tmp" + strconv.Itoa(os.Getpid())
+	err = copyFile(file, temp)
+	if err != nil {
+		os.Remove(temp)
+		return err
+	}
+	err = storeDownload(base, temp, cachedDownload{URL: src, ETag: etag, LastModified: modified, Fetched: time.Now().UTC()})
+	if err != nil {
+		return err
+	}
+
+	return pruneDownloadCache(filepath.Dir(base))
+}
+
+// storeDownload moves a complete temporary copy of a download into the
+// cache and writes its validators next to it
+func storeDownload(base, temp string, index cachedDownload) error {
+	err := os.Rename(temp, base+".data")
+	if err != nil {
+		os.Remove(temp)
+		return err
+	}
+
+	return writeJSON(base+".json", index)
+}
+
+// cachedDownloads returns every download in the cache whose data is present
+func cachedDownloads() ([]*cachedDownload, error) {
+	base, err := downloadCacheFile("")
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Dir(base)
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var downloads []*cachedDownload
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		base := filepath.Join(dir, strings.TrimSuffix(entry.Name(), ".json"))
+		data, err := os.ReadFile(base + ".json")
+		if err != nil {
+			return nil, err
+		}
+		var cached cachedDownload
+		if json.Unmarshal(data, &cached) != nil {
+			continue
+		}
+		cached.data = base + ".data"
+		if _, err := os.Stat(cached.data); err != nil {
+			continue
+		}
+		downloads = append(downloads, &cached)
+	}
+
+	return downloads, nil
+}
+
+// pruneDownloadCache removes the least recently used downloads until the
+// cache fits downloadCacheLimit
+func pruneDownloadCache(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	var files []os.FileInfo
+	var total int64
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), ".data") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, info)
+		total += info.Size()
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].ModTime().Before(files[j].ModTime())
+	})
+
+	for _, info := range files {
+		if total <= downloadCacheLimit {
+			break
+		}
+		base := filepath.Join(dir, strings.TrimSuffix(info.Name(), ".data"))
+		os.Remove(base + ".json")
+		err = os.Remove(base + ".data")
+		if err != nil {
+			return err
+		}
+		total -= info.Size()
+	}
+
+	return nil
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"errors"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// captureDevice records a clip from a camera into a temporary file, which
+// is then converted like any other source
+func (c *converter) captureDevice() error {
+	var input []string
+	switch runtime.GOOS {
+	case "linux":
+		input = []string{"-f", "v4l2", "-i", c.device}
+	case "darwin":
+		// avfoundation rejects most cameras at its default frame rate
+		input = []string{"-f", "avfoundation", "-framerate", "30", "-i", c.device}
+	case "windows":
+		device := c.device
+		if !strings.HasPrefix(device, "video=") {
+			device = "video=" + device
+		}
+		input = []string{"-f", "dshow", "-i", device}
+	default:
+		return errors.New("Camera capture is not supported on " + runtime.GOOS)
+	}
+
+	c.fileToConvert = c.tempPath(tempFileName + c.suffix() + ".mkv")
+	seconds := strconv.FormatFloat(c.captureLength.Seconds(), 'f', -1, 64)
+	args := append([]string{"-y", "-t", seconds}, input...)
+	args = append(args, "-an", "-c:v", "libx264", "-preset", "ultrafast", "-pix_fmt", "yuv420p", c.fileToConvert)
+
+	return runFFmpeg("capture", c.captureLength, args)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Frame rate of generated cards when the source's is unknown
+const cardFrameRate = 15
+
+// displaySize returns the size of the source frames once the rotation
+// filters have turned them upright and -auto-crop has cut them
+func (c *converter) displaySize() (int, int) {
+	if c.crop != nil {
+		return c.crop.width, c.crop.height
+	}
+
+	width, height := c.meta.Width, c.meta.Height
+	if !c.noAutorotate && (c.meta.Rotation == 90 || c.meta.Rotation == 270) {
+		width, height = height, width
+	}
+
+	return width, height
+}
+
+func (c *converter) validateCards() error {
+	if (c.titleCard != "" || c.endCard != "") && c.cardDuration <= 0 {
+		return errors.New("-card-duration must be positive")
+	}
+
+	return nil
+}
+
+// cardFilter puts a generated text card before and after the clip. Cards
+// are rendered at the source size so the segments can be joined before
+// scaling.
+func (c *converter) cardFilter() string {
+	if c.titleCard == "" && c.endCard == "" {
+		return ""
+	}
+
+	width, height := c.displaySize()
+	rate := c.meta.FrameRate
+	if c.meta.Still {
+		rate = stillFrameRate
+	} else if rate == 0 {
+		rate = cardFrameRate
+	}
+	card := func(file, label string) string {
+		return fmt.Sprintf("color=c=black:s=%dx%d:r=%s:d=%s,setsar=1,drawtext=textfile=%s:expansion=none:fontcolor=white:fontsize=h/10:x=(w-text_w)/2:y=(h-text_h)/2[%s];",
+			width, height, strconv.FormatFloat(rate, 'f', -1, 64), strconv.FormatFloat(c.cardDuration.Seconds(), 'f', -1, 64), filterPath(file), label)
+	}
+
+	graph := "setsar=1[cclip];"
+	segments, n := "[cclip]", 1
+	if c.titleCard != "" {
+		graph += card(c.cardFile("title"), "ctitle")
+		segments, n = "[ctitle]"+segments, n+1
+	}
+	if c.endCard != "" {
+		graph += card(c.cardFile("end"), "cend")
+		segments, n = segments+"[cend]", n+1
+	}
+
+	return graph + segments + fmt.Sprintf("concat=n=%d:v=1:a=0", n)
+}
+
+// cardsDuration returns how much the cards add to the output
+func (c *converter) cardsDuration() time.Duration {
+	var total time.Duration
+	if c.titleCard != "" {
+		total += c.cardDuration
+	}
+	if c.endCard != "" {
+		total += c.cardDuration
+	}
+
+	return total
+}
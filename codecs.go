@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// decoderLibraries names what to look for in an ffmpeg build that cannot
+// decode a codec, for codecs that older or minimal builds often lack
+var decoderLibraries = map[string]string{
+	"av1":  "libdav1d",
+	"vp9":  "libvpx-vp9",
+	"hevc": "the hevc decoder",
+}
+
+var decoderList = regexp.MustCompile(`\(decoders: ([^)]*)\)`)
+
+// ffmpegCodecs maps the codecs ffmpeg knows to their decoders, or holds
+// nil when ffmpeg cannot list them
+var ffmpegCodecs struct {
+	once     sync.Once
+	decoders map[string][]string
+}
+
+// codecDecoders returns the decoders ffmpeg has for a codec, and false when
+// this is unknown
+func codecDecoders(codec string) ([]string, bool) {
+	ffmpegCodecs.once.Do(func() {
+		out, err := exec.Command("ffmpeg", "-hide_banner", "-codecs").Output()
+		if err != nil {
+			return
+		}
+		ffmpegCodecs.decoders = parseCodecs(string(out))
+	})
+	if ffmpegCodecs.decoders == nil {
+		return nil, false
+	}
+
+	return ffmpegCodecs.decoders[codec], true
+}
+
+// parseCodecs reads the output of ffmpeg -codecs, whose lines start with
+// flags such as DEV.LS, D meaning the codec can be decoded
+func parseCodecs(out string) map[string][]string {
+	codecs := make(map[string][]string)
+	_, list, ok := strings.Cut(out, "-------")
+	if !ok {
+		return nil
+	}
+	for _, line := range strings.Split(list, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || len(fields[0]) != 6 || fields[0][0] != 'D' {
+			continue
+		}
+		name := fields[1]
+		codecs[name] = []string{name}
+		if m := decoderList.FindStringSubmatch(line); m != nil {
+			codecs[name] = strings.Fields(m[1])
+		}
+	}
+
+	return codecs
+}
+
+// checkDecoder makes sure ffmpeg can decode the video of the source. When
+// its default decoder fails on the first frame, the other decoders of the
+// codec are tried and the first that works is used for the job.
+func (c *converter) checkDecoder() error {
+	codec := c.meta.Codec
+	// Mirrors and migrated outputs are never decoded
+	if codec == "" || c.meta.AudioOnly || c.unchanged {
+		return nil
+	}
+	decoders, known := codecDecoders(codec)
+	if !known {
+		return nil
+	}
+	if len(decoders) == 0 {
+		build := "one"
+		if lib, ok := decoderLibraries[codec]; ok {
+			build = lib
+		}
+		return fmt.Errorf(tr("This ffmpeg has no decoder for %s video; install an ffmpeg built with %s, or re-encode the source to H.264"), codec, build)
+	}
+
+	err := c.testDecode("")
+	if err == nil {
+		return nil
+	}
+	for _, decoder := range decoders {
+		if c.testDecode(decoder) == nil {
+			c.decoder = decoder
+			c.warn(warnDecoder, fmt.Errorf(tr("ffmpeg could not decode the %s video (%v), decoding it with %s"), codec, err, decoder))
+			return nil
+		}
+	}
+
+	return fmt.Errorf(tr("ffmpeg could not decode the %s video of the source with any of its decoders (%s): %v"), codec, strings.Join(decoders, ", "), err)
+}
+
+// testDecode decodes the first video frame of the source, with the given
+// decoder or ffmpeg's default one. The error is the last line ffmpeg
+// printed, not all of its output.
+func (c *converter) testDecode(decoder string) error {
+	args := []string{"-hide_banner", "-v", "error"}
+	if decoder != "" {
+		args = append(args, "-c:v", decoder)
+	}
+	args = append(args, "-i", c.fileToConvert, "-map", "0:v:0", "-frames:v", "1", "-f", "null", "-")
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(shutdownCtx, "ffmpeg", args...)
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if err == nil {
+		return nil
+	}
+
+	lines := strings.Split(strings.TrimSpace(stderr.String()), "\n")
+	if last := strings.TrimSpace(lines[len(lines)-1]); last != "" {
+		return errors.New(last)
+	}
+	return err
+}
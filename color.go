@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+const (
+	colorRed   = "31"
+	colorGreen = "32"
+	colorCyan  = "36"
+)
+
+// Colors are decided separately for each stream so a captured stdout stays
+// plain while stderr on a terminal is still colored
+var stdoutColor, stderrColor bool
+
+// setupColor enables colors for terminal outputs unless disabled with
+// -no-color, NO_COLOR (https://no-color.org) or a dumb terminal
+func setupColor(noColor bool) {
+	if noColor || os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return
+	}
+
+	stdoutColor = isTerminal(os.Stdout)
+	stderrColor = isTerminal(os.Stderr)
+}
+
+func colorize(enabled bool, code, s string) string {
+	if !enabled {
+		return s
+	}
+
+	return "\x1b[" + code + "m" + s + "\x1b[0m"
+}
+
+// stage reports a completed stage of a job on stderr
+func stage(name, detail string) {
+	progressLine.println(os.Stderr, fmt.Sprintf("%s %-8s %s", colorize(stderrColor, colorGreen, "ok"), name, detail))
+}
+
+func printError(err error) {
+	progressLine.println(os.Stderr, colorize(stderrColor, colorRed, err.Error()))
+}
@@ -0,0 +1,813 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+func (c *converter) convert() error {
+	defer timed(&c.timings.Convert)()
+
+	// Convert movie to the output format
+	name, err := c.outputName()
+	if err != nil {
+		return err
+	}
+	name = c.workPath(name)
+	if len(c.widths) > 1 {
+		return c.convertWidths(name)
+	}
+
+	output := name + "." + c.format
+	if sameFile(output, c.fileToConvert) {
+		// Reprocessing demo.gif with -keep-name writes demo-output.gif
+		output = name + "-" + outputFileName + "." + c.format
+	}
+	if sameFile(output, c.fileToConvert) {
+		return fmt.Errorf(tr("Output would overwrite the input file: %s"), output)
+	}
+	c.outputImage = partialPath(output)
+	if c.passThrough() {
+		return c.copySource()
+	}
+
+	err = c.writeTexts()
+	if err != nil {
+		return err
+	}
+	defer c.removeTexts()
+
+	for {
+		args := append(c.inputArgs(), "-vf", strings.Join(c.filters(c.imageWidth), ","))
+		args = append(args, c.encoderArgs()...)
+		output, err := c.ffmpegOutput()
+		if err != nil {
+			return err
+		}
+		err = c.runFFmpeg(append(args, output...))
+		if err != nil {
+			return err
+		}
+		err = c.quantize()
+		if err != nil {
+			return err
+		}
+		// Outputs that are never converted again are optimized in the background
+		if !c.retunable() {
+			return nil
+		}
+
+		err = c.optimize()
+		if err != nil {
+			return err
+		}
+
+		if c.fallBack() {
+			continue
+		}
+
+		again, err := c.retune()
+		if !again {
+			return err
+		}
+	}
+}
+
+// inputArgs returns the ffmpeg options reading the source, including trimming
+func (c *converter) inputArgs() []string {
+	args := []string{"-noautorotate"}
+	// Seeking would skip the only frame of a still image
+	if c.trim != "" && !c.meta.Still {
+		start, end, _ := parseTrim(c.trim)
+		if start != "" {
+			args = append(args, "-ss", start)
+		}
+		if end != "" {
+			args = append(args, "-to", end)
+		}
+	}
+
+	// A decoder picked by checkDecoder applies to the source only
+	if c.decoder != "" {
+		args = append(args, "-c:v", c.decoder)
+	}
+
+	return append(args, "-i", c.fileToConvert)
+}
+
+// parseTrim splits a START-END range. Times are seconds or [HH:]MM:SS[.ms].
+func parseTrim(trim string) (string, string, error) {
+	parts := strings.Split(trim, "-")
+	if len(parts) != 2 {
+		return "", "", errors.New("Trim must be given as START-END, e.g. 2-6.5")
+	}
+
+	start := strings.TrimSpace(parts[0])
+	end := strings.TrimSpace(parts[1])
+	for _, t := range []string{start, end} {
+		if t == "" {
+			continue
+		}
+		if _, err := parseTimestamp(t); err != nil {
+			return "", "", errors.New("Invalid trim time: " + t)
+		}
+	}
+
+	return start, end, nil
+}
+
+// parseTimestamp parses seconds or [HH:]MM:SS[.ms] as used by ffmpeg
+func parseTimestamp(t string) (time.Duration, error) {
+	var seconds float64
+	for _, part := range strings.Split(t, ":") {
+		n, err := strconv.ParseFloat(part, 64)
+		if err != nil || n < 0 {
+			return 0, errors.New("invalid timestamp " + t)
+		}
+		seconds = seconds*60 + n
+	}
+
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// convertWidths decodes the source once and splits the frames into one
+// scaled output per width. Each output becomes a variant of the job.
+func (c *converter) convertWidths(name string) error {
+	graph := "[0:v]"
+	if source := c.sourceFilters(); len(source) > 0 {
+		graph += strings.Join(source, ",") + ","
+	}
+	graph += fmt.Sprintf("split=%d", len(c.widths))
+	for i := range c.widths {
+		graph += fmt.Sprintf("[s%d]", i)
+	}
+
+	var outputArgs []string
+	c.variants = nil
+	for i, width := range c.widths {
+		graph += fmt.Sprintf(";[s%d]%s[o%d]", i, strings.Join(c.scaleFilters(width), ","), i)
+
+		v := *c
+		v.imageWidth = width
+		v.widths = nil
+		v.variants = nil
+		v.outputImage = name + "-" + width + "." + c.format
+		v.index = c.index
+		if sameFile(v.outputImage, c.fileToConvert) {
+			return fmt.Errorf(tr("Output would overwrite the input file: %s"), v.outputImage)
+		}
+		v.outputImage = partialPath(v.outputImage)
+		c.variants = append(c.variants, &v)
+
+		outputArgs = append(outputArgs, "-map", fmt.Sprintf("[o%d]", i))
+		if c.keepAudio && !c.mute {
+			outputArgs = append(outputArgs, "-map", "0:a?")
+		}
+		outputArgs = append(outputArgs, c.encoderArgs()...)
+		output, err := v.ffmpegOutput()
+		if err != nil {
+			return err
+		}
+		outputArgs = append(outputArgs, output...)
+	}
+
+	err := c.writeTexts()
+	if err != nil {
+		return err
+	}
+	defer c.removeTexts()
+
+	args := append(c.inputArgs(), "-filter_complex", graph)
+	err = c.runFFmpeg(append(args, outputArgs...))
+	if err != nil {
+		return err
+	}
+	for _, v := range c.variants {
+		err = v.quantize()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// filters returns the complete filter chain producing an output of width
+func (c *converter) filters(width string) []string {
+	return append(c.sourceFilters(), c.scaleFilters(width)...)
+}
+
+// sourceFilters returns the filters applied once to the source frames,
+// before they are scaled to each output width
+func (c *converter) sourceFilters() []string {
+	filters := append(c.frameFilters(), c.rotationFilters()...)
+	if c.stabilize && !c.meta.Still {
+		filters = append(filters, c.stabilizeFilter())
+	}
+	filters = append(filters, c.blurFilters()...)
+	if c.crop != nil {
+		filters = append(filters, c.crop.filter())
+	}
+	if c.meta.Still {
+		filters = append(filters, c.zoompanFilter())
+	}
+	if c.speed != 1 {
+		filters = append(filters, "setpts=PTS/"+strconv.FormatFloat(c.speed, 'f', -1, 64))
+	}
+	// Frames are interpolated after retiming so slowed down clips are filled
+	// in up to the requested rate
+	if c.interpolate > 0 {
+		filters = append(filters, "minterpolate=fps="+strconv.Itoa(c.interpolate)+":mi_mode=mci:mc_mode=aobmc:vsbmc=1")
+	}
+	if hold := c.holdFilter(); hold != "" {
+		filters = append(filters, hold)
+	}
+	if c.loopCrossfade > 0 {
+		filters = append(filters, c.crossfadeFilter())
+	}
+	if cards := c.cardFilter(); cards != "" {
+		filters = append(filters, cards)
+	}
+	if aspect := c.aspectFilter(); aspect != "" {
+		filters = append(filters, aspect)
+	}
+
+	return filters
+}
+
+// rotationFilters turns the video upright. Rotation is applied by our own
+// filters so the result does not depend on whether ffmpeg autorotates.
+func (c *converter) rotationFilters() []string {
+	if c.noAutorotate {
+		return nil
+	}
+
+	return c.meta.rotationFilters()
+}
+
+func (c *converter) scaleFilters(width string) []string {
+	var filters []string
+	if c.preset != nil && c.preset.scale != "" {
+		filters = append(filters, c.preset.scale)
+	} else if c.format == "gif" && c.textMode {
+		filters = append(filters, c.textScale(width, "-1"))
+	} else if c.format == "gif" {
+		filters = append(filters, "scale="+width+":-1")
+	} else if c.textMode {
+		filters = append(filters, c.textScale(width, "-2"))
+	} else {
+		// Video encoders need even dimensions
+		filters = append(filters, "scale="+width+":-2")
+	}
+	if c.preset != nil {
+		filters = append(filters, c.presetFilter())
+	}
+	if c.meta.HDR && !c.noTonemap {
+		filters = append(filters, tonemapFilter)
+	}
+	if c.caption != "" {
+		filters = append(filters, "drawtext=textfile="+filterPath(c.captionFile())+":expansion=none:fontcolor=white:fontsize=h/14:box=1:boxcolor=black@0.5:boxborderw=6:x=(w-text_w)/2:y=h-text_h-12")
+	}
+	if c.progressBar {
+		filters = append(filters, c.progressFilter(width))
+	}
+	switch {
+	case c.format != "gif" || c.framesQuantized():
+	case c.palette != "":
+		filters = append(filters, c.sharedPaletteFilter(width))
+	case c.gifSource():
+		filters = append(filters, paletteFilter(width))
+	case c.textMode:
+		filters = append(filters, textPaletteFilter(width))
+	case c.quantizer == "palettegen":
+		filters = append(filters, palettegenFilter(width))
+	}
+
+	return filters
+}
+
+// holdFilter repeats the first and last frames so loops pause on them
+func (c *converter) holdFilter() string {
+	var options []string
+	if c.holdFirst > 0 {
+		options = append(options, "start_mode=clone:start_duration="+strconv.FormatFloat(c.holdFirst.Seconds(), 'f', -1, 64))
+	}
+	if c.holdLast > 0 {
+		options = append(options, "stop_mode=clone:stop_duration="+strconv.FormatFloat(c.holdLast.Seconds(), 'f', -1, 64))
+	}
+	if len(options) == 0 {
+		return ""
+	}
+
+	return "tpad=" + strings.Join(options, ":")
+}
+
+// gifSource reports whether the input is itself a GIF
+func (c *converter) gifSource() bool {
+	return c.meta.Codec == "gif"
+}
+
+// paletteFilter computes an optimal palette for the output instead of the
+// fixed palette ffmpeg uses by default. GIF sources already have few colors,
+// so they are mapped without dithering and keep their transparency. Labels
+// are suffixed so several widths can share a filter graph.
+func paletteFilter(suffix string) string {
+	return fmt.Sprintf("split[pa%[1]s][pb%[1]s];[pa%[1]s]palettegen=reserve_transparent=1[pp%[1]s];[pb%[1]s][pp%[1]s]paletteuse=dither=none:alpha_threshold=128", suffix)
+}
+
+// palettegenFilter is -quantizer palettegen: a palette computed from all the
+// frames of the output, mapped with dithering
+func palettegenFilter(suffix string) string {
+	return fmt.Sprintf("split[pa%[1]s][pb%[1]s];[pa%[1]s]palettegen=stats_mode=full[pp%[1]s];[pb%[1]s][pp%[1]s]paletteuse=dither=sierra2_4a", suffix)
+}
+
+// The caption and card texts are passed to drawtext through files, which
+// avoids escaping arbitrary text for the filter graph
+func (c *converter) captionFile() string {
+	return c.tempPath(captionFileName + c.suffix() + ".txt")
+}
+
+func (c *converter) cardFile(card string) string {
+	return c.tempPath(captionFileName + "_" + card + c.suffix() + ".txt")
+}
+
+// texts maps each text file used by the filters to its content
+func (c *converter) texts() map[string]string {
+	texts := make(map[string]string)
+	if c.caption != "" {
+		texts[c.captionFile()] = c.caption
+	}
+	if c.titleCard != "" {
+		texts[c.cardFile("title")] = c.titleCard
+	}
+	if c.endCard != "" {
+		texts[c.cardFile("end")] = c.endCard
+	}
+
+	return texts
+}
+
+func (c *converter) writeTexts() error {
+	for file, text := range c.texts() {
+		err := os.WriteFile(file, []byte(text), 0644)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *converter) removeTexts() {
+	for file := range c.texts() {
+		os.Remove(file)
+	}
+}
+
+// runFFmpeg runs the conversion with ffmpeg
+func (c *converter) runFFmpeg(args []string) error {
+	return runFFmpeg("convert", c.expectedDuration(), args)
+}
+
+// runFFmpeg runs ffmpeg, following its progress towards total on the status
+// line under the name of the stage
+func runFFmpeg(stage string, total time.Duration, args []string) error {
+	act := beginStage(stage)
+	defer act.end()
+
+	global := append([]string{"-progress", "pipe:1", "-nostats"}, threadArgs()...)
+	ffmpeg := exec.CommandContext(shutdownCtx, "ffmpeg", append(global, args...)...)
+
+	var ffmpegErr bytes.Buffer
+	ffmpeg.Stderr = &ffmpegErr
+
+	stdout, err := ffmpeg.StdoutPipe()
+	if err != nil {
+		return err
+	}
+
+	err = ffmpeg.Start()
+	if err != nil {
+		return err
+	}
+	watchFFmpegProgress(stdout, act, total)
+
+	err = ffmpeg.Wait()
+	if err != nil {
+		return errors.New(fmt.Sprint(err) + ": " + ffmpegErr.String())
+	}
+
+	return nil
+}
+
+// expectedDuration returns the duration of the output, taking trimming and
+// presets into account, or zero if it is unknown
+func (c *converter) expectedDuration() time.Duration {
+	total := c.clipDuration()
+	if total > 0 {
+		total += c.cardsDuration() - c.loopCrossfade
+	}
+	if c.preset != nil {
+		if length := c.maxLength(); length > 0 && (total == 0 || total > length) {
+			return length
+		}
+	}
+
+	return total
+}
+
+// clipDuration returns the duration of the clip after retiming and holds,
+// before it is crossfaded into a loop, or zero if it is unknown
+func (c *converter) clipDuration() time.Duration {
+	total := c.trimmedDuration()
+	if c.meta.Still {
+		total = c.stillDuration
+	}
+
+	total = time.Duration(float64(total) / c.speed)
+	if total > 0 {
+		total += c.holdFirst + c.holdLast
+	}
+
+	return total
+}
+
+// trimmedDuration returns the duration of the source after trimming, or zero
+// if it is unknown
+func (c *converter) trimmedDuration() time.Duration {
+	if c.frameRange != "" {
+		return c.framesDuration()
+	}
+
+	total := c.meta.Duration
+	if c.trim == "" {
+		return total
+	}
+
+	start, end, _ := parseTrim(c.trim)
+	if end != "" {
+		if t, err := parseTimestamp(end); err == nil && (total == 0 || t < total) {
+			total = t
+		}
+	}
+	if start != "" {
+		if t, err := parseTimestamp(start); err == nil {
+			total -= t
+		}
+	}
+	if total < 0 {
+		return 0
+	}
+
+	return total
+}
+
+func (c *converter) optimize() error {
+	if c.format != "gif" {
+		return nil
+	}
+
+	optimizeSlots <- struct{}{}
+	defer func() { <-optimizeSlots }()
+	act := beginStage("optimize")
+	defer act.end()
+
+	if c.optimizerTool() == "builtin" {
+		return c.optimizeBuiltin()
+	}
+
+	// Delays are set on the full frames, before they are optimized
+	if c.frameDelay != "" {
+		if err := c.applyDelays(); err != nil {
+			return err
+		}
+	}
+
+	// Optimize gif
+	args := []string{"--careful", "-O3"}
+	if c.preset != nil && c.tuned().colors > 0 {
+		args = append(args, "--colors", strconv.Itoa(c.tuned().colors))
+	}
+	sickle := exec.CommandContext(shutdownCtx, "gifsicle", append(args, "--batch", c.outputImage)...)
+
+	var sicklekErr bytes.Buffer
+	sickle.Stderr = &sicklekErr
+
+	err := sickle.Run()
+	if err != nil {
+		return errors.New(fmt.Sprint(err) + ": " + sicklekErr.String())
+	}
+
+	return nil
+}
+
+// outputs returns the variants of a multi width job, or the job itself
+func (c *converter) outputs() []*converter {
+	if len(c.variants) > 0 {
+		return c.variants
+	}
+
+	return []*converter{c}
+}
+
+// srcset returns an img tag offering every variant of the job by width
+func (c *converter) srcset() string {
+	var set []string
+	for _, v := range c.variants {
+		set = append(set, v.endImage+" "+v.imageWidth+"w")
+	}
+
+	return fmt.Sprintf(`<img src="%s" srcset="%s"%s>`, c.variants[0].endImage, strings.Join(set, ", "), c.htmlAlt())
+}
+
+// encoderArgs returns the ffmpeg output options, limiting the duration and
+// frame count for presets
+func (c *converter) encoderArgs() []string {
+	var args []string
+	if c.preset != nil && c.preset.maxDuration > 0 {
+		args = []string{"-t", strconv.FormatFloat(c.preset.maxDuration.Seconds(), 'f', -1, 64)}
+	}
+	if c.preset != nil && c.preset.maxFrames > 0 {
+		// Longer clips are cut rather than rejected, saying how much is kept
+		if total := c.clipDuration(); total > 0 && total+c.cardsDuration()-c.loopCrossfade > c.maxLength() {
+			stage("trim", fmt.Sprintf(tr("%[1]s allows %[2]d frames, keeping the first %[3]s at %[4]d fps; use -trim to pick the part"), c.preset.name, c.preset.maxFrames, c.maxLength().Round(100*time.Millisecond), c.tuned().frameRate))
+		}
+		args = append(args, "-frames:v", strconv.Itoa(c.preset.maxFrames))
+	}
+	if ffmpegThreads > 0 {
+		args = append(args, "-threads", strconv.Itoa(ffmpegThreads))
+	}
+
+	return append(args, c.formatArgs()...)
+}
+
+// formatArgs returns the codec options of the output format
+func (c *converter) formatArgs() []string {
+	switch c.format {
+	case "mp4":
+		args := []string{"-c:v", "libx264", "-pix_fmt", "yuv420p", "-movflags", "+faststart"}
+		if c.preset != nil {
+			args = append(args, "-crf", strconv.Itoa(c.tuned().crf))
+		}
+		return append(args, c.audioArgs("aac")...)
+	case "webm":
+		crf := "33"
+		if c.preset != nil {
+			crf = strconv.Itoa(c.tuned().crf)
+		}
+		args := []string{"-c:v", "libvpx-vp9", "-b:v", "0", "-crf", crf}
+		return append(args, c.audioArgs("libopus")...)
+	}
+
+	if c.framesQuantized() {
+		return []string{"-pix_fmt", "rgb24"}
+	}
+	if c.gifSource() || c.palette != "" || c.textMode || c.quantizer == "palettegen" {
+		// Keep the palette, and transparency, from the palette filters
+		return []string{"-f", "gif"}
+	}
+
+	return []string{"-pix_fmt", "rgb24", "-f", "gif"}
+}
+
+// audioArgs transcodes the audio track into codec when it is kept for video
+// outputs, and drops it otherwise
+func (c *converter) audioArgs(codec string) []string {
+	// Some platforms with presets do not play sound
+	if c.keepAudio && !c.mute && (c.preset == nil || !c.preset.noAudio) {
+		var filters []string
+		if c.frameRange != "" {
+			filters = append(filters, c.frameAudioFilter())
+		}
+		if c.speed != 1 {
+			filters = append(filters, "atempo="+strconv.FormatFloat(c.speed, 'f', -1, 64))
+		}
+		// Start the sound after the title card
+		if c.titleCard != "" {
+			filters = append(filters, "adelay=delays="+strconv.FormatInt(c.cardDuration.Milliseconds(), 10)+":all=1")
+		}
+
+		args := []string{"-c:a", codec}
+		if len(filters) > 0 {
+			args = append(args, "-af", strings.Join(filters, ","))
+		}
+		return args
+	}
+
+	return []string{"-an"}
+}
+
+type nameFields struct {
+	Name    string
+	Title   string
+	Date    string
+	Created time.Time
+}
+
+// outputName returns the output file name without extension
+func (c *converter) outputName() (string, error) {
+	if c.nameTmpl == nil {
+		if c.assetName != "" {
+			return c.assetName, nil
+		}
+		if c.keepName {
+			return c.sourceName(), nil
+		}
+		return outputFileName + c.suffix(), nil
+	}
+
+	fields := nameFields{
+		Name:    c.sourceName(),
+		Title:   c.meta.Title,
+		Created: c.meta.CreationTime,
+	}
+	if !fields.Created.IsZero() {
+		fields.Date = fields.Created.Format("2006-01-02")
+	}
+
+	var b bytes.Buffer
+	err := c.nameTmpl.Execute(&b, fields)
+	if err != nil {
+		return "", err
+	}
+
+	if strings.TrimSpace(b.String()) == "" {
+		return c.sourceName(), nil
+	}
+
+	// Keep the output in the working directory
+	return sanitizeName(b.String()), nil
+}
+
+// uploadOverwrite reports whether the output was named on purpose, with
+// -keep-name or -name-template, so that an upload under the same name to
+// GitHub or Confluence replaces the earlier file
+func (c *converter) uploadOverwrite() bool {
+	return c.keepName || c.nameTmpl != nil
+}
+
+// uploadName returns the name of the output on hosts that keep one file
+// per name. Default names such as output.gif get a hash of the content, so
+// a new upload never replaces the file an older link points to.
+func (c *converter) uploadName(data []byte) string {
+	name := filepath.Base(c.outputImage)
+	if c.uploadOverwrite() {
+		return name
+	}
+	sum := sha256.Sum256(data)
+	ext := filepath.Ext(name)
+
+	return strings.TrimSuffix(name, ext) + "-" + hex.EncodeToString(sum[:6]) + ext
+}
+
+// uploadTitle returns the title to give the upload, preferring the title
+// of a mirrored imgur image and then the title stored in the source's
+// metadata
+func (c *converter) uploadTitle() string {
+	if c.mirrorTitle != "" {
+		return c.mirrorTitle
+	}
+	if c.meta != nil && c.meta.Title != "" {
+		return c.meta.Title
+	}
+	if c.keepName {
+		return c.sourceName()
+	}
+
+	return ""
+}
+
+// sourceName returns the base name of the input without its extension
+func (c *converter) sourceName() string {
+	name := filepath.Base(c.startImage)
+	if isRemote(c.startImage) {
+		if u, err := url.Parse(c.startImage); err == nil {
+			name = path.Base(u.Path)
+		}
+	}
+
+	name = strings.TrimSuffix(name, path.Ext(name))
+	if name == "" || name == "." || name == "/" {
+		return outputFileName
+	}
+
+	return sanitizeName(name)
+}
+
+// optimizeSlots bounds the number of gifsicle processes running at once
+var optimizeSlots = make(chan struct{}, runtime.NumCPU())
+
+// ffmpegThreads is the number of threads each ffmpeg process may use for
+// filtering and encoding, or zero for ffmpeg's own choice
+var ffmpegThreads int
+
+// threads returns -threads, defaulting to the CPU count. Conversions run one
+// at a time, but overlap with the optimizations of earlier jobs when there
+// are several -optimize-jobs, which then get half of the CPUs.
+func (c *converter) threads() int {
+	if c.threadCount > 0 {
+		return c.threadCount
+	}
+	if c.optimizeJobs > 1 {
+		return max(1, runtime.NumCPU()/2)
+	}
+
+	return runtime.NumCPU()
+}
+
+// threadArgs returns the global thread options of ffmpeg. -threads itself
+// is an option of each input or output rather than a global one, and is
+// given to the encoder of each output by encoderArgs.
+func threadArgs() []string {
+	if ffmpegThreads == 0 {
+		return nil
+	}
+
+	return []string{"-filter_threads", strconv.Itoa(ffmpegThreads)}
+}
+
+// retunable reports whether the output may have to be converted again
+// after it is optimized, to fit a size limit
+func (c *converter) retunable() bool {
+	return c.preset != nil || c.fallback != "" || c.onLimit == "retune"
+}
+
+// optimizeOutputs optimizes the outputs of a job concurrently, returning
+// the first error
+func optimizeOutputs(outputs []*converter) error {
+	errs := make([]error, len(outputs))
+	var wg sync.WaitGroup
+	for i, o := range outputs {
+		wg.Add(1)
+		go func(i int, o *converter) {
+			defer wg.Done()
+			errs[i] = o.optimize()
+		}(i, o)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// partialOutputPrefix marks outputs that are still being written. They are
+// renamed to their final name once finished, so an interrupted run never
+// leaves a truncated file that looks like a result.
+const partialOutputPrefix = ".partial-"
+
+// partialPath returns the name an output is written under until it is
+// finished
+func partialPath(output string) string {
+	return filepath.Join(filepath.Dir(output), partialOutputPrefix+filepath.Base(output))
+}
+
+// commitOutputs renames finished outputs into place. With -fsync their
+// data is flushed first and the rename after, for shares that must never
+// show a partial file.
+func commitOutputs(outputs []*converter) error {
+	for _, o := range outputs {
+		name := filepath.Base(o.outputImage)
+		if !strings.HasPrefix(name, partialOutputPrefix) {
+			continue
+		}
+		if o.fsync {
+			err := syncFile(o.outputImage)
+			if err != nil {
+				return err
+			}
+		}
+		dir := filepath.Dir(o.outputImage)
+		final := filepath.Join(dir, strings.TrimPrefix(name, partialOutputPrefix))
+		err := retryBusy(func() error { return os.Rename(o.outputImage, final) })
+		if err != nil {
+			return err
+		}
+		o.outputImage = final
+		if o.fsync {
+			err = syncDir(dir)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
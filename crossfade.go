@@ -0,0 +1,36 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// checkCrossfade makes sure the clip is long enough to fade its end into its
+// start. It needs the probed duration, so runs after the source is fetched.
+func (c *converter) checkCrossfade() error {
+	if c.loopCrossfade == 0 {
+		return nil
+	}
+
+	clip := c.clipDuration()
+	if clip == 0 {
+		return errors.New("-loop-crossfade needs a source with a known duration")
+	}
+	if clip <= 2*c.loopCrossfade {
+		return fmt.Errorf("The clip is too short for a %s -loop-crossfade", c.loopCrossfade)
+	}
+
+	return nil
+}
+
+// crossfadeFilter blends the last part of the clip into its first part, so
+// the output ends where it starts and loops without a cut. The output is
+// shorter than the clip by the length of the fade.
+func (c *converter) crossfadeFilter() string {
+	fade := strconv.FormatFloat(c.loopCrossfade.Seconds(), 'f', -1, 64)
+	offset := strconv.FormatFloat((c.clipDuration() - 2*c.loopCrossfade).Seconds(), 'f', -1, 64)
+
+	return fmt.Sprintf("split[xbody][xhead];[xhead]trim=end=%[1]s,setpts=PTS-STARTPTS[xstart];"+
+		"[xbody]trim=start=%[1]s,setpts=PTS-STARTPTS[xrest];[xrest][xstart]xfade=transition=fade:duration=%[1]s:offset=%[2]s", fade, offset)
+}
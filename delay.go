@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// frameDelay sets the delay of a range of output frames. last is -1 for the
+// last frame of the GIF.
+type frameDelay struct {
+	first, last int
+	// centiseconds, the unit of GIF frame delays
+	delay int
+}
+
+// parseDelays parses a comma separated list of RANGE:DELAY items, where the
+// range is a frame number, START-END, START- or first and last, e.g.
+// "0-10:100ms,last:2s"
+func parseDelays(spec string) ([]frameDelay, error) {
+	var delays []frameDelay
+	for _, item := range strings.Split(spec, ",") {
+		frames, delay, ok := strings.Cut(strings.TrimSpace(item), ":")
+		if !ok {
+			return nil, errors.New("Frame delays must be given as RANGE:DELAY, e.g. 0-10:100ms,last:2s")
+		}
+
+		d, err := time.ParseDuration(strings.TrimSpace(delay))
+		if err != nil || d < 0 {
+			return nil, errors.New("Invalid frame delay: " + delay)
+		}
+		fd := frameDelay{delay: int(math.Round(d.Seconds() * 100))}
+
+		start, end, isRange := strings.Cut(strings.TrimSpace(frames), "-")
+		fd.first, err = frameNumber(start)
+		if err != nil {
+			return nil, err
+		}
+		fd.last = fd.first
+		if isRange {
+			fd.last = -1
+			if end != "" {
+				fd.last, err = frameNumber(end)
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+		if fd.first == -1 && fd.last != -1 || fd.last != -1 && fd.last < fd.first {
+			return nil, errors.New("Invalid frame range: " + frames)
+		}
+
+		delays = append(delays, fd)
+	}
+
+	return delays, nil
+}
+
+func frameNumber(s string) (int, error) {
+	switch s = strings.TrimSpace(s); s {
+	case "first":
+		return 0, nil
+	case "last":
+		return -1, nil
+	}
+
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return 0, errors.New("Invalid frame number: " + s)
+	}
+
+	return n, nil
+}
+
+// applyDelays rewrites the frame delays of the GIF output with gifsicle.
+// Every frame has to be selected, so unchanged frames keep their delays.
+func (c *converter) applyDelays() error {
+	current, err := gifDelays(c.outputImage)
+	if err != nil {
+		return err
+	}
+	current, err = setDelays(c.frameDelay, current)
+	if err != nil {
+		return err
+	}
+
+	// Consecutive frames with the same delay share a selection
+	args := []string{"--careful", c.outputImage}
+	for start := 0; start < len(current); {
+		end := start
+		for end+1 < len(current) && current[end+1] == current[start] {
+			end++
+		}
+		args = append(args, "-d", strconv.Itoa(current[start]), fmt.Sprintf("#%d-%d", start, end))
+		start = end + 1
+	}
+
+	temp := c.outputImage + ".tmp"
+	out, err := exec.CommandContext(shutdownCtx, "gifsicle", append(args, "-o", temp)...).CombinedOutput()
+	if err != nil {
+		os.Remove(temp)
+		return errors.New(fmt.Sprint(err) + ": " + string(out))
+	}
+
+	return os.Rename(temp, c.outputImage)
+}
+
+// setDelays changes the frame delays in centiseconds according to spec
+func setDelays(spec string, current []int) ([]int, error) {
+	delays, err := parseDelays(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, d := range delays {
+		first, last := d.first, d.last
+		if first == -1 {
+			first = len(current) - 1
+		}
+		if last == -1 || last >= len(current) {
+			last = len(current) - 1
+		}
+		if first >= len(current) {
+			return nil, fmt.Errorf("-frame-delay frame %d is past the last frame %d", d.first, len(current)-1)
+		}
+		for i := first; i <= last; i++ {
+			current[i] = d.delay
+		}
+	}
+
+	return current, nil
+}
+
+// gifDelays returns the delay of every frame of a GIF in centiseconds, as
+// listed by gifsicle --info
+func gifDelays(file string) ([]int, error) {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(shutdownCtx, "gifsicle", "--info", file)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, errors.New(fmt.Sprint(err) + ": " + stderr.String())
+	}
+
+	images := strings.Split(string(out), "+ image #")
+	var delays []int
+	for _, image := range images[1:] {
+		delay := 0
+		fields := strings.Fields(image)
+		for i, field := range fields {
+			if field == "delay" && i+1 < len(fields) {
+				seconds, _ := strconv.ParseFloat(strings.TrimSuffix(fields[i+1], "s"), 64)
+				delay = int(math.Round(seconds * 100))
+			}
+		}
+		delays = append(delays, delay)
+	}
+	if len(delays) == 0 {
+		return nil, errors.New("No frames found in " + file)
+	}
+
+	return delays, nil
+}
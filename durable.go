@@ -0,0 +1,41 @@
+package main
+
+import (
+	"os"
+	"time"
+)
+
+const busyRetries = 5
+
+// retryBusy runs op again while the file it works on is busy, waiting a
+// little longer each time
+func retryBusy(op func() error) error {
+	wait := 100 * time.Millisecond
+	for i := 0; ; i++ {
+		err := op()
+		if err == nil || !isBusy(err) || i == busyRetries {
+			return err
+		}
+		select {
+		case <-time.After(wait):
+		case <-shutdownCtx.Done():
+			return err
+		}
+		wait *= 2
+	}
+}
+
+// syncFile flushes the data of a file to its storage
+func syncFile(path string) error {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	err = f.Sync()
+	if err != nil {
+		return err
+	}
+
+	return f.Close()
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"errors"
+	"syscall"
+)
+
+// Windows reports a file another process has open as a sharing or lock
+// violation
+const (
+	errorSharingViolation syscall.Errno = 32
+	errorLockViolation    syscall.Errno = 33
+)
+
+func isBusy(err error) bool {
+	return errors.Is(err, errorSharingViolation) || errors.Is(err, errorLockViolation)
+}
+
+// syncDir does nothing, directories cannot be flushed on Windows and a
+// rename is durable once it returns
+func syncDir(dir string) error {
+	return nil
+}
@@ -0,0 +1,79 @@
+//go:build ignore
+
+// extract_messages adds the messages passed to tr in the Go files of this
+// directory to a catalog, keeping existing translations, e.g.
+//
+//	go run extract_messages.go de
+//
+// New messages get an empty translation, which falls back to English.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+func main() {
+	if len(os.Args) != 2 {
+		fmt.Fprintln(os.Stderr, "Usage: go run extract_messages.go <lang>")
+		os.Exit(2)
+	}
+	catalog := filepath.Join("locales", os.Args[1]+".json")
+
+	messages := map[string]string{}
+	if data, err := os.ReadFile(catalog); err == nil {
+		if err := json.Unmarshal(data, &messages); err != nil {
+			fmt.Fprintln(os.Stderr, catalog+":", err)
+			os.Exit(1)
+		}
+	}
+
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, ".", nil, 0)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	found := 0
+	for _, pkg := range pkgs {
+		for _, file := range pkg.Files {
+			ast.Inspect(file, func(n ast.Node) bool {
+				call, ok := n.(*ast.CallExpr)
+				if !ok || len(call.Args) != 1 {
+					return true
+				}
+				if fn, ok := call.Fun.(*ast.Ident); !ok || fn.Name != "tr" {
+					return true
+				}
+				lit, ok := call.Args[0].(*ast.BasicLit)
+				if !ok || lit.Kind != token.STRING {
+					fmt.Fprintln(os.Stderr, fset.Position(call.Pos()), "tr needs a string literal")
+					return true
+				}
+				msg, _ := strconv.Unquote(lit.Value)
+				if _, ok := messages[msg]; !ok {
+					messages[msg] = ""
+					found++
+				}
+				return true
+			})
+		}
+	}
+
+	data, err := json.MarshalIndent(messages, "", "  ")
+	if err == nil {
+		err = os.WriteFile(catalog, append(data, '\n'), 0644)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Printf("%s: %d new messages\n", catalog, found)
+}
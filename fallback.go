@@ -0,0 +1,54 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+func (c *converter) validateFallback() error {
+	switch {
+	case c.fallback == "":
+		return nil
+	case c.fallback != "mp4" && c.fallback != "webm":
+		return errors.New("-fallback must be mp4 or webm")
+	case c.format != "gif":
+		return errors.New("-fallback only applies to gif outputs")
+	case c.preset != nil:
+		return errors.New("-fallback cannot be combined with -preset")
+	case len(c.widths) > 1:
+		return errors.New("-fallback cannot be combined with -widths")
+	}
+
+	return nil
+}
+
+// sizeBudget returns the largest GIF to keep, set by -max-size or the upload
+// limit
+func (c *converter) sizeBudget() int64 {
+	if c.maxSize > 0 {
+		return int64(c.maxSize)
+	}
+
+	return c.uploadLimit()
+}
+
+// fallBack replaces an optimized GIF over the size budget with a video in
+// the fallback format, usually a fraction of the size. It reports whether the
+// output has to be converted again.
+func (c *converter) fallBack() bool {
+	budget := c.sizeBudget()
+	size := fileSize(c.outputImage)
+	if c.fallback == "" || c.format != "gif" || budget == 0 || size <= budget {
+		return false
+	}
+
+	gif := c.outputImage
+	c.format = c.fallback
+	c.outputImage = strings.TrimSuffix(gif, ".gif") + "." + c.format
+	stage("fallback", fmt.Sprintf(tr("%s is %dKB, over the %dKB budget; converting to %s"), gif, size>>10, budget>>10, c.format))
+	os.Remove(gif)
+
+	return true
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	feedStateFileName = "feeds.json"
+	// feedStateEntries is how many entry IDs are remembered for each feed,
+	// well over the length of a typical feed
+	feedStateEntries = 1000
+)
+
+// feedDocument covers both RSS 2.0 and Atom. Media is taken from
+// enclosures, Media RSS content elements or Atom enclosure links.
+type feedDocument struct {
+	Items   []feedItem `xml:"channel>item"`
+	Entries []feedItem `xml:"entry"`
+}
+
+type feedItem struct {
+	GUID       string          `xml:"guid"`
+	ID         string          `xml:"id"`
+	Links      []feedLink      `xml:"link"`
+	Enclosures []feedEnclosure `xml:"enclosure"`
+	Media      []feedEnclosure `xml:"http://search.yahoo.com/mrss/ content"`
+	Groups     []struct {
+		Media []feedEnclosure `xml:"http://search.yahoo.com/mrss/ content"`
+	} `xml:"http://search.yahoo.com/mrss/ group"`
+}
+
+// feedLink is an RSS link with the URL as text or an Atom link with href
+type feedLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr"`
+	Text string `xml:",chardata"`
+}
+
+type feedEnclosure struct {
+	URL  string `xml:"url,attr"`
+	Type string `xml:"type,attr"`
+}
+
+// media returns the URL to convert: the first video or GIF attached to the
+// entry, otherwise its page when a resolver rule or plugin may find the
+// media behind it
+func (item feedItem) media() string {
+	enclosures := append(item.Enclosures, item.Media...)
+	for _, group := range item.Groups {
+		enclosures = append(enclosures, group.Media...)
+	}
+	for _, link := range item.Links {
+		if link.Rel == "enclosure" {
+			enclosures = append(enclosures, feedEnclosure{URL: link.Href, Type: link.Type})
+		}
+	}
+	for _, e := range enclosures {
+		if e.URL != "" && (strings.HasPrefix(e.Type, "video/") || e.Type == "image/gif") {
+			return e.URL
+		}
+	}
+
+	for _, link := range item.Links {
+		page := strings.TrimSpace(link.Text)
+		if link.Href != "" && (link.Rel == "" || link.Rel == "alternate") {
+			page = link.Href
+		}
+		if page != "" {
+			if canResolve(page) {
+				return page
+			}
+			return ""
+		}
+	}
+
+	return ""
+}
+
+// id identifies the entry across runs
+func (item feedItem) id() string {
+	for _, id := range []string{item.GUID, item.ID, item.media()} {
+		if id = strings.TrimSpace(id); id != "" {
+			return id
+		}
+	}
+
+	return ""
+}
+
+// feedSource tracks which entries of a feed were converted between runs.
+// The state of every feed is kept in one file, by feed URL.
+type feedSource struct {
+	url     string
+	path    string
+	state   map[string][]string
+	skipped []string
+	pending map[*converter]string
+}
+
+// feedStatePath returns the file keeping the state of every feed
+func feedStatePath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, keyringService, feedStateFileName), nil
+}
+
+// loadFeed fetches a feed and returns a job for every entry not converted
+// by an earlier run, oldest first
+func loadFeed(feedURL string, defaults *converter) ([]*converter, *feedSource, error) {
+	path, err := feedStatePath()
+	if err != nil {
+		return nil, nil, err
+	}
+	feed := &feedSource{
+		url:     feedURL,
+		path:    path,
+		state:   make(map[string][]string),
+		pending: make(map[*converter]string),
+	}
+	data, err := os.ReadFile(feed.path)
+	if err == nil {
+		err = json.Unmarshal(data, &feed.state)
+		if err != nil {
+			return nil, nil, errors.New(feedStateFileName + ": " + err.Error())
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, nil, err
+	}
+
+	doc, err := defaults.fetchFeed(feedURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	items := append(doc.Items, doc.Entries...)
+
+	seen := make(map[string]bool)
+	for _, id := range feed.state[feedURL] {
+		seen[id] = true
+	}
+	var jobs []*converter
+	// Feeds list the newest entries first
+	for i := len(items) - 1; i >= 0; i-- {
+		id := items[i].id()
+		if id == "" || seen[id] {
+			continue
+		}
+		seen[id] = true
+		source := items[i].media()
+		if source == "" {
+			feed.skipped = append(feed.skipped, id)
+			continue
+		}
+
+		job := *defaults
+		job.startImage = source
+		err = job.validate()
+		if err != nil {
+			return nil, nil, errors.New(source + ": " + err.Error())
+		}
+		jobs = append(jobs, &job)
+		feed.pending[&job] = id
+	}
+
+	return jobs, feed, nil
+}
+
+func (c *converter) fetchFeed(feedURL string) (*feedDocument, error) {
+	u, err := url.Parse(feedURL)
+	if err != nil {
+		return nil, err
+	}
+	err = c.checkHost(u.Hostname())
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(shutdownCtx, "GET", feedURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	act := beginStage("feed")
+	defer act.end()
+	resp, err := c.fetchClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf(tr("Feed %s returned %s"), feedURL, resp.Status)
+	}
+
+	var doc feedDocument
+	err = xml.NewDecoder(c.throttle(resp.Body)).Decode(&doc)
+	if err != nil {
+		return nil, errors.New(feedURL + ": " + err.Error())
+	}
+
+	return &doc, nil
+}
+
+// save records the converted entries, and those without media, so the next
+// run skips them. Failed jobs are left out so they are retried.
+func (f *feedSource) save(jobs []*converter) error {
+	ids := append(f.state[f.url], f.skipped...)
+	for _, c := range jobs {
+		if id, ok := f.pending[c]; ok && c.err == nil {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) > feedStateEntries {
+		ids = ids[len(ids)-feedStateEntries:]
+	}
+	f.state[f.url] = ids
+
+	err := os.MkdirAll(filepath.Dir(f.path), 0700)
+	if err != nil {
+		return err
+	}
+
+	return writeJSON(f.path, f.state)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parseFrames splits a START:END range of frame numbers. Both ends are
+// inclusive and either may be left out, in which case end is -1.
+func parseFrames(frames string) (int, int, error) {
+	parts := strings.Split(frames, ":")
+	if len(parts) != 2 {
+		return 0, 0, errors.New("Frames must be given as START:END, e.g. 120:300")
+	}
+
+	start, end := 0, -1
+	var err error
+	if s := strings.TrimSpace(parts[0]); s != "" {
+		start, err = strconv.Atoi(s)
+		if err != nil || start < 0 {
+			return 0, 0, errors.New("Invalid start frame: " + s)
+		}
+	}
+	if s := strings.TrimSpace(parts[1]); s != "" {
+		end, err = strconv.Atoi(s)
+		if err != nil || end < start {
+			return 0, 0, errors.New("Invalid end frame: " + s)
+		}
+	}
+
+	return start, end, nil
+}
+
+// frameFilters select the frame range and shift it to start at zero
+func (c *converter) frameFilters() []string {
+	if c.frameRange == "" {
+		return nil
+	}
+
+	start, end, _ := parseFrames(c.frameRange)
+	selection := fmt.Sprintf(`gte(n\,%d)`, start)
+	if end >= 0 {
+		selection = fmt.Sprintf(`between(n\,%d\,%d)`, start, end)
+	}
+
+	return []string{"select=" + selection, "setpts=PTS-STARTPTS"}
+}
+
+// frameTimes returns the start and end of the frame range in seconds, based
+// on the average frame rate. End is zero when the range is open.
+func (c *converter) frameTimes() (float64, float64) {
+	start, end, _ := parseFrames(c.frameRange)
+	if c.meta.FrameRate == 0 {
+		return 0, 0
+	}
+
+	startTime := float64(start) / c.meta.FrameRate
+	if end < 0 {
+		return startTime, 0
+	}
+
+	return startTime, float64(end+1) / c.meta.FrameRate
+}
+
+// frameAudioFilter cuts kept audio to the time span of the frame range
+func (c *converter) frameAudioFilter() string {
+	start, end := c.frameTimes()
+	filter := "atrim=start=" + strconv.FormatFloat(start, 'f', -1, 64)
+	if end > 0 {
+		filter += ":end=" + strconv.FormatFloat(end, 'f', -1, 64)
+	}
+
+	return filter + ",asetpts=PTS-STARTPTS"
+}
+
+// framesDuration returns the duration of the frame range, or zero if it is
+// unknown
+func (c *converter) framesDuration() time.Duration {
+	start, end := c.frameTimes()
+	if end == 0 {
+		end = c.meta.Duration.Seconds()
+	}
+	if end <= start {
+		return 0
+	}
+
+	return time.Duration((end - start) * float64(time.Second))
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+const (
+	galleryIndexName  = "index.html"
+	galleryThumbsDir  = "thumbs"
+	galleryThumbWidth = 240
+)
+
+type galleryItem struct {
+	Source string
+	Link   string
+	Thumb  string
+	Alt    string
+}
+
+var galleryTemplate = template.Must(template.New("gallery").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>GIF Gallery</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+.item { display: inline-block; margin: 0 1em 1em 0; vertical-align: top; }
+.item img { display: block; }
+.item span { font-size: 0.8em; color: #666; }
+</style>
+</head>
+<body>
+{{range .}}<div class="item">
+<a href="{{.Link}}"><img src="{{.Thumb}}" alt="{{.Alt}}" loading="lazy"></a>
+<span>{{.Source}}</span>
+</div>
+{{end}}</body>
+</html>
+`))
+
+// writeGallery writes an index.html into dir showing every converted job.
+// Outputs that were not uploaded are copied into dir so the page is self
+// contained. The page shows a small still of each output from the thumbs
+// directory, which loads quickly however many outputs there are.
+func writeGallery(dir string, jobs []*converter) error {
+	err := os.MkdirAll(filepath.Join(dir, galleryThumbsDir), 0755)
+	if err != nil {
+		return err
+	}
+
+	var items []galleryItem
+	names := entryNames{galleryIndexName: true, galleryThumbsDir: true}
+	for _, c := range jobs {
+		name := names.add(c.outputImage)
+		link := c.endImage
+		if !c.uploaded() {
+			link = name
+			err = copyFile(c.outputImage, filepath.Join(dir, link))
+			if err != nil {
+				return err
+			}
+		}
+		thumb := path.Join(galleryThumbsDir, name+".png")
+		err = runFFmpeg("gallery", 0, []string{"-y", "-i", c.outputImage, "-frames:v", "1",
+			"-vf", fmt.Sprintf("scale='min(%d,iw)':-1", galleryThumbWidth), filepath.Join(dir, filepath.FromSlash(thumb))})
+		if err != nil {
+			return err
+		}
+		alt := c.alt
+		if alt == "" {
+			alt = c.startImage
+		}
+		items = append(items, galleryItem{Source: c.startImage, Link: link, Thumb: thumb, Alt: alt})
+	}
+
+	f, err := os.Create(filepath.Join(dir, galleryIndexName))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	err = galleryTemplate.Execute(f, items)
+	if err != nil {
+		return err
+	}
+
+	return f.Close()
+}
+
+func copyFile(src, dst string) error {
+	if sameFile(src, dst) {
+		return nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	_, err = io.Copy(out, in)
+	if err != nil {
+		return err
+	}
+
+	return out.Close()
+}
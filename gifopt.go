@@ -0,0 +1,194 @@
+package main
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"os"
+	"os/exec"
+)
+
+// optimizerTool returns the optimizer used for -optimizer auto: gifsicle
+// when it is installed, the built-in one otherwise
+func (c *converter) optimizerTool() string {
+	if c.optimizer != "auto" {
+		return c.optimizer
+	}
+	if _, err := exec.LookPath("gifsicle"); err != nil {
+		return "builtin"
+	}
+
+	return "gifsicle"
+}
+
+// errOptimizeSkipped is returned by optimizeGIF for GIFs it cannot improve
+// without changing how they look
+var errOptimizeSkipped = errors.New("GIF left unoptimized")
+
+// optimizeBuiltin optimizes the output in-process, for systems without
+// gifsicle. It is less thorough and does not reduce colors.
+func (c *converter) optimizeBuiltin() error {
+	err := optimizeGIF(c.outputImage, func(delays []int) ([]int, error) {
+		if c.frameDelay == "" {
+			return delays, nil
+		}
+		return setDelays(c.frameDelay, delays)
+	})
+	if err == errOptimizeSkipped {
+		c.warn(warnNotOptimized, errors.New(c.outputImage+" has changing transparency and was left as converted"))
+		return nil
+	}
+
+	return err
+}
+
+// optimizeGIF crops each frame to the area that changed since the previous
+// one and makes the unchanged pixels inside it transparent, so they compress
+// to almost nothing. Frames that change nothing are dropped, their delay
+// added to the frame before. retime may change the frame delays first.
+func optimizeGIF(file string, retime func([]int) ([]int, error)) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	g, err := gif.DecodeAll(f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+
+	g.Delay, err = retime(g.Delay)
+	if err != nil {
+		return err
+	}
+
+	bounds := image.Rect(0, 0, g.Config.Width, g.Config.Height)
+	// canvas is what the source GIF displays, shown what the optimized one does
+	canvas := image.NewRGBA(bounds)
+	shown := image.NewRGBA(bounds)
+	out := &gif.GIF{
+		LoopCount:       g.LoopCount,
+		Config:          g.Config,
+		BackgroundIndex: g.BackgroundIndex,
+	}
+
+	for i, img := range g.Image {
+		before := cloneRGBA(canvas)
+		draw.Draw(canvas, img.Bounds(), img, img.Bounds().Min, draw.Over)
+
+		changed, ok := changedRect(shown, canvas)
+		if !ok {
+			return errOptimizeSkipped
+		}
+		if changed.Empty() && len(out.Image) > 0 {
+			out.Delay[len(out.Delay)-1] += g.Delay[i]
+		} else {
+			if changed.Empty() {
+				changed = image.Rect(0, 0, 1, 1)
+			}
+			out.Image = append(out.Image, diffFrame(img, shown, canvas, changed))
+			out.Delay = append(out.Delay, g.Delay[i])
+			out.Disposal = append(out.Disposal, gif.DisposalNone)
+			draw.Draw(shown, changed, canvas, changed.Min, draw.Src)
+		}
+
+		disposal := byte(gif.DisposalNone)
+		if i < len(g.Disposal) {
+			disposal = g.Disposal[i]
+		}
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, img.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			canvas = before
+		}
+	}
+
+	temp := file + ".tmp"
+	w, err := os.Create(temp)
+	if err != nil {
+		return err
+	}
+	err = gif.EncodeAll(w, out)
+	if closeErr := w.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(temp)
+		return err
+	}
+
+	return os.Rename(temp, file)
+}
+
+// changedRect returns the bounding box of the pixels that differ between
+// the two canvases. It fails when a pixel turns transparent, which frames
+// drawn on top of each other cannot express.
+func changedRect(shown, next *image.RGBA) (image.Rectangle, bool) {
+	var r image.Rectangle
+	b := next.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			i := next.PixOffset(x, y)
+			a, n := shown.Pix[i:i+4], next.Pix[i:i+4]
+			if a[0] == n[0] && a[1] == n[1] && a[2] == n[2] && a[3] == n[3] {
+				continue
+			}
+			if n[3] == 0 {
+				return r, false
+			}
+			r = r.Union(image.Rect(x, y, x+1, y+1))
+		}
+	}
+
+	return r, true
+}
+
+// diffFrame builds the frame covering rect that turns shown into next,
+// using the palette of the source frame
+func diffFrame(src *image.Paletted, shown, next *image.RGBA, rect image.Rectangle) *image.Paletted {
+	palette := append(color.Palette(nil), src.Palette...)
+	transparent := -1
+	for i, c := range palette {
+		if _, _, _, a := c.RGBA(); a == 0 {
+			transparent = i
+			break
+		}
+	}
+	if transparent == -1 && len(palette) < 256 {
+		transparent = len(palette)
+		palette = append(palette, color.RGBA{})
+	}
+
+	frame := image.NewPaletted(rect, palette)
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			i := next.PixOffset(x, y)
+			a, n := shown.Pix[i:i+4], next.Pix[i:i+4]
+			unchanged := a[0] == n[0] && a[1] == n[1] && a[2] == n[2] && a[3] == n[3]
+			switch {
+			case unchanged && transparent >= 0:
+				frame.SetColorIndex(x, y, uint8(transparent))
+			case image.Pt(x, y).In(src.Bounds()) && src.RGBA64At(x, y).A == 0xffff && rgbaEqual(src.At(x, y), n):
+				frame.SetColorIndex(x, y, src.ColorIndexAt(x, y))
+			default:
+				frame.SetColorIndex(x, y, uint8(palette.Index(color.RGBA{n[0], n[1], n[2], n[3]})))
+			}
+		}
+	}
+
+	return frame
+}
+
+func rgbaEqual(c color.Color, p []uint8) bool {
+	r, g, b, a := c.RGBA()
+	return uint8(r>>8) == p[0] && uint8(g>>8) == p[1] && uint8(b>>8) == p[2] && uint8(a>>8) == p[3]
+}
+
+func cloneRGBA(m *image.RGBA) *image.RGBA {
+	c := image.NewRGBA(m.Bounds())
+	copy(c.Pix, m.Pix)
+	return c
+}
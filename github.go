@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	githubAPIEndpoint  = "https://api.github.com"
+	keyringGitHubToken = "github-token"
+)
+
+type githubContent struct {
+	SHA         string `json:"sha"`
+	DownloadURL string `json:"download_url"`
+}
+
+// uploadGitHub attaches the output to a release when -github-release is set
+// and commits it to -github-path in the repository otherwise.
+func (c *converter) uploadGitHub() error {
+	if strings.TrimSpace(c.githubToken) == "" {
+		return errors.New("A GitHub token is required, set GITHUB_TOKEN or run: go-gif-pr auth set " + keyringGitHubToken)
+	}
+	if strings.Count(c.githubRepo, "/") != 1 {
+		return errors.New("GitHub repository must be given as owner/repo")
+	}
+
+	data, err := os.ReadFile(c.outputImage)
+	if err != nil {
+		return err
+	}
+
+	if c.githubRelease != "" {
+		return c.uploadReleaseAsset(data)
+	}
+
+	return c.commitContent(data)
+}
+
+func (c *converter) uploadReleaseAsset(data []byte) error {
+	var release githubRelease
+	err := c.githubRequest("GET", githubAPIEndpoint+"/repos/"+c.githubRepo+"/releases/tags/"+url.PathEscape(c.githubRelease), nil, "", &release)
+	if err != nil {
+		return err
+	}
+
+	// upload_url is a URI template such as .../assets{?name,label}
+	uploadURL := release.UploadURL
+	if i := strings.Index(uploadURL, "{"); i != -1 {
+		uploadURL = uploadURL[:i]
+	}
+	name := c.uploadName(data)
+	for _, asset := range release.Assets {
+		if asset.Name != name {
+			continue
+		}
+		if !c.uploadOverwrite() {
+			// The name is unique to the content, the same file is attached
+			c.endImage = asset.URL
+			return nil
+		}
+		return errors.New("Release " + c.githubRelease + " already has an asset named " + name)
+	}
+	uploadURL += "?name=" + url.QueryEscape(name)
+
+	contentType := mime.TypeByExtension(filepath.Ext(name))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	var asset struct {
+		URL string `json:"browser_download_url"`
+	}
+	err = c.githubRequest("POST", uploadURL, data, contentType, &asset)
+	if err != nil {
+		return err
+	}
+
+	c.endImage = asset.URL
+	return nil
+}
+
+func (c *converter) commitContent(data []byte) error {
+	filePath := path.Join(c.githubPath, c.uploadName(data))
+	contentsURL := githubAPIEndpoint + "/repos/" + c.githubRepo + "/contents/" + filePath
+
+	body := map[string]string{
+		"message": "Add " + filePath,
+		"content": base64.StdEncoding.EncodeToString(data),
+	}
+	if c.githubBranch != "" {
+		body["branch"] = c.githubBranch
+	}
+
+	// Updating an existing file requires its current blob SHA
+	existingURL := contentsURL
+	if c.githubBranch != "" {
+		existingURL += "?ref=" + url.QueryEscape(c.githubBranch)
+	}
+	var existing githubContent
+	if c.githubRequest("GET", existingURL, nil, "", &existing) == nil && existing.SHA != "" {
+		if !c.uploadOverwrite() {
+			// The name is unique to the content, the same file is committed
+			c.endImage = existing.DownloadURL
+			return nil
+		}
+		body["sha"] = existing.SHA
+		body["message"] = "Update " + filePath
+	}
+
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	var result struct {
+		Content githubContent `json:"content"`
+	}
+	err = c.githubRequest("PUT", contentsURL, payload, "application/json", &result)
+	if err != nil {
+		return err
+	}
+
+	c.endImage = result.Content.DownloadURL
+	return nil
+}
+
+// githubRequest sends an authenticated API request and decodes the JSON
+// response into v
+func (c *converter) githubRequest(method, target string, body []byte, contentType string, v interface{}) error {
+	req, err := http.NewRequestWithContext(shutdownCtx, method, target, c.throttle(bytes.NewReader(body)))
+	if err != nil {
+		return err
+	}
+	req.ContentLength = int64(len(body))
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Authorization", "Bearer "+c.githubToken)
+
+	client := &http.Client{
+		Timeout: c.timeout,
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		json.NewDecoder(resp.Body).Decode(&apiErr)
+		return errors.New("GitHub error: " + resp.Status + " " + apiErr.Message)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,365 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const historyFileName = "history.jsonl"
+
+// historyEntry is a line of the history file: the report of an output,
+// stamped with the time of the run and the tags of its job
+type historyEntry struct {
+	Time         time.Time `json:"time"`
+	Tags         []string  `json:"tags,omitempty"`
+	Uploader     string    `json:"uploader,omitempty"`
+	MigratedFrom string    `json:"migrated_from,omitempty"`
+	reportEntry
+}
+
+// tagList is a repeatable flag of labels. Each value may also list several
+// tags separated by commas.
+type tagList []string
+
+func (t *tagList) String() string {
+	return strings.Join(*t, ",")
+}
+
+func (t *tagList) Set(value string) error {
+	for _, tag := range strings.Split(value, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "" {
+			return errors.New("Tags cannot be empty")
+		}
+		*t = append(*t, tag)
+	}
+
+	return nil
+}
+
+func (t tagList) has(tag string) bool {
+	for _, have := range t {
+		if strings.EqualFold(have, tag) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// historyPath returns the history file, GIFV_HISTORY_FILE if set and
+// otherwise history.jsonl in the user's configuration directory
+func historyPath() (string, error) {
+	if path := os.Getenv("GIFV_HISTORY_FILE"); path != "" {
+		return path, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, keyringService, historyFileName), nil
+}
+
+// recordHistory appends an entry per converted output to the history file
+func recordHistory(jobs []*converter) error {
+	path, err := historyPath()
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	enc := json.NewEncoder(f)
+	for _, c := range jobs {
+		entry := historyEntry{Time: now, Tags: c.tags, reportEntry: c.reportEntry()}
+		if c.uploaded() {
+			entry.Uploader = c.uploader
+		}
+		if c.migration != nil {
+			entry = c.migratedEntry(entry)
+		}
+		// The history outlives the working directory of the run
+		if output, err := filepath.Abs(entry.Output); err == nil && entry.Output != "" {
+			entry.Output = output
+		}
+		err = enc.Encode(entry)
+		if err != nil {
+			return err
+		}
+	}
+
+	return f.Close()
+}
+
+// readHistory returns the entries of the history file, oldest first. A
+// missing file is an empty history.
+func readHistory(path string) ([]historyEntry, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return decodeHistory(f, path)
+}
+
+func decodeHistory(r io.Reader, name string) ([]historyEntry, error) {
+	var entries []historyEntry
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var entry historyEntry
+		err := json.Unmarshal(scanner.Bytes(), &entry)
+		if err != nil {
+			return nil, fmt.Errorf("%s: line %d: %v", name, line, err)
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, scanner.Err()
+}
+
+// historyExport is the file written by history export. Next to the entries
+// it carries the state that lets another machine skip the work already
+// done: the converted feed entries, the resolver rules, the hashes and URLs
+// of an assets directory and optionally the cached downloads.
+type historyExport struct {
+	History   []historyEntry         `json:"history"`
+	Feeds     map[string][]string    `json:"feeds,omitempty"`
+	Resolvers []json.RawMessage      `json:"resolvers,omitempty"`
+	Assets    map[string]*assetState `json:"assets,omitempty"`
+	Downloads []exportedDownload     `json:"downloads,omitempty"`
+}
+
+// historyCommand lists past conversions, optionally only those carrying
+// every given tag
+func historyCommand(args []string) error {
+	if len(args) > 0 && (args[0] == "export" || args[0] == "import") {
+		flags := flag.NewFlagSet("history "+args[0], flag.ContinueOnError)
+		assetsPath := flags.String("assets-dir", "", "Also "+args[0]+" the state of this assets directory.")
+		var downloads *bool
+		if args[0] == "export" {
+			downloads = flags.Bool("downloads", false, "Also export the cached downloads, copied to a directory next to the file.")
+		}
+		err := flags.Parse(args[1:])
+		if err != nil {
+			return err
+		}
+		if flags.NArg() != 1 {
+			return errors.New("Usage: go-gif-pr history export [--assets-dir DIR] [--downloads] <file.json> | import [--assets-dir DIR] <file.json>")
+		}
+		path, err := historyPath()
+		if err != nil {
+			return err
+		}
+		if args[0] == "export" {
+			return exportHistory(path, flags.Arg(0), *assetsPath, *downloads)
+		}
+		return importHistory(path, flags.Arg(0), *assetsPath)
+	}
+
+	flags := flag.NewFlagSet("history", flag.ContinueOnError)
+	var tags tagList
+	flags.Var(&tags, "tag", "Only list conversions with this tag. May be repeated.")
+	asJSON := flags.Bool("json", false, "Print the entries as JSON lines.")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		return errors.New("Usage: go-gif-pr history [--tag NAME]... [--json] | export|import <file.json>")
+	}
+
+	path, err := historyPath()
+	if err != nil {
+		return err
+	}
+	entries, err := readHistory(path)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+entries:
+	for _, entry := range entries {
+		for _, tag := range tags {
+			if !tagList(entry.Tags).has(tag) {
+				continue entries
+			}
+		}
+
+		if *asJSON {
+			err = enc.Encode(entry)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		result := entry.URL
+		if result == "" {
+			result = entry.Output
+		}
+		line := entry.Time.Local().Format("2006-01-02 15:04") + "  " + result + "  " + entry.Source
+		if len(entry.Tags) > 0 {
+			line += "  [" + strings.Join(entry.Tags, ", ") + "]"
+		}
+		fmt.Println(line)
+	}
+
+	return nil
+}
+
+// exportHistory writes the history and the state kept with it to target,
+// or standard output for -
+func exportHistory(path, target, assetsPath string, downloads bool) error {
+	entries, err := readHistory(path)
+	if err != nil {
+		return err
+	}
+	if entries == nil {
+		entries = []historyEntry{}
+	}
+	export := historyExport{History: entries}
+	downloadsDir := ""
+	if downloads {
+		if target == "-" {
+			return errors.New("--downloads copies the downloads next to the export and needs a file, not -")
+		}
+		downloadsDir = exportDownloadsDir(target)
+	}
+	err = export.collectState(assetsPath, downloadsDir)
+	if err != nil {
+		return err
+	}
+
+	out := os.Stdout
+	if target != "-" {
+		out, err = os.Create(target)
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+	}
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	err = enc.Encode(export)
+	if err != nil {
+		return err
+	}
+	if target != "-" {
+		stage("export", fmt.Sprintf(tr("%d entries to %s"), len(entries), target))
+		return out.Close()
+	}
+
+	return nil
+}
+
+// importHistory merges the entries of an exported file into the history,
+// skipping those already recorded, and keeps the history in time order.
+// The state in the file is merged into the local one the same way.
+func importHistory(path, source, assetsPath string) error {
+	f, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var imported historyExport
+	err = json.NewDecoder(f).Decode(&imported)
+	if err != nil {
+		return errors.New(source + ": " + err.Error())
+	}
+	if len(imported.Assets) > 0 && assetsPath == "" {
+		return errors.New(source + " has the state of an assets directory, import it with --assets-dir DIR")
+	}
+
+	entries, err := readHistory(path)
+	if err != nil {
+		return err
+	}
+	seen := make(map[string]bool)
+	for _, entry := range entries {
+		seen[entry.key()] = true
+	}
+	added := 0
+	for _, entry := range imported.History {
+		if seen[entry.key()] {
+			continue
+		}
+		seen[entry.key()] = true
+		entries = append(entries, entry)
+		added++
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Time.Before(entries[j].Time)
+	})
+
+	err = writeHistory(path, entries)
+	if err != nil {
+		return err
+	}
+	stage("import", fmt.Sprintf(tr("%d new entries from %s"), added, source))
+
+	return imported.restoreState(assetsPath, filepath.Dir(source))
+}
+
+// key identifies an entry, so imports can be repeated without duplicates
+func (e historyEntry) key() string {
+	return strings.Join([]string{e.Time.UTC().Format(time.RFC3339), e.Source, e.Output, e.URL}, "\x00")
+}
+
+// writeHistory replaces the history file. The entries are written to a
+// temporary file first so an interrupted import leaves the history intact.
+func writeHistory(path string, entries []historyEntry) error {
+	err := os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), historyFileName+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	enc := json.NewEncoder(f)
+	for _, entry := range entries {
+		err = enc.Encode(entry)
+		if err != nil {
+			return err
+		}
+	}
+	err = f.Chmod(0600)
+	if err != nil {
+		return err
+	}
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
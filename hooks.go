@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// runHook runs a user supplied shell command for a pipeline stage. The
+// command learns about the job through GIFV_ environment variables and its
+// output goes to stderr, keeping stdout for results.
+func (c *converter) runHook(name, command, file, url string) error {
+	if command == "" {
+		return nil
+	}
+
+	act := beginStage(name)
+	defer act.end()
+
+	cmd := shellCommand(command)
+	cmd.Env = c.hookEnv(name, file, url)
+
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	err := cmd.Run()
+
+	scanner := bufio.NewScanner(&out)
+	for scanner.Scan() {
+		progressLine.println(os.Stderr, scanner.Text())
+	}
+
+	if err != nil {
+		return errors.New(fmt.Sprint(name, " hook failed: ", err, ": ", strings.TrimSpace(command)))
+	}
+
+	return nil
+}
+
+// shellCommand runs command with the shell of the platform
+func shellCommand(command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.CommandContext(shutdownCtx, "cmd", "/C", command)
+	}
+
+	return exec.CommandContext(shutdownCtx, "sh", "-c", command)
+}
+
+// hookEnv returns the environment describing the job to user commands
+func (c *converter) hookEnv(stage, file, url string) []string {
+	return append(os.Environ(),
+		"GIFV_STAGE="+stage,
+		"GIFV_SOURCE="+c.startImage,
+		"GIFV_FILE="+file,
+		"GIFV_URL="+url,
+		"GIFV_FORMAT="+c.format,
+		"GIFV_WIDTH="+c.imageWidth,
+	)
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// matchHost reports whether host is one of the comma separated hosts or a
+// subdomain of one
+func matchHost(host, hosts string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, h := range strings.Split(hosts, ",") {
+		h = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(h), "*."))
+		if h != "" && (host == h || strings.HasSuffix(host, "."+h)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkHost applies -allow-hosts and -deny-hosts to a source host
+func (c *converter) checkHost(host string) error {
+	if c.denyHosts != "" && matchHost(host, c.denyHosts) {
+		return fmt.Errorf(tr("Downloads from %s are denied by -deny-hosts"), host)
+	}
+	if c.allowHosts != "" && !matchHost(host, c.allowHosts) {
+		return fmt.Errorf(tr("Downloads from %s are not allowed by -allow-hosts"), host)
+	}
+
+	return nil
+}
+
+// internalPrefixes are the networks not covered by the netip checks that
+// still never belong to a public host: carrier-grade NAT, "this network" and
+// the benchmarking range
+var internalPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+}
+
+// privateIP reports whether ip is on a loopback, private, link-local or
+// other internal network, which sources from untrusted manifests must not
+// reach. IPv4 addresses written as IPv6, such as ::ffff:127.0.0.1, are
+// checked as the IPv4 address they are.
+func privateIP(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsUnspecified() {
+		return true
+	}
+	for _, prefix := range internalPrefixes {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// fetchClient returns the HTTP client for downloading sources. Redirects
+// are checked against the host lists, and with -block-private-ips the
+// address is checked after it is resolved, so DNS names pointing at internal
+// addresses are refused too. HTTP_PROXY and HTTPS_PROXY are then ignored.
+func (c *converter) fetchClient() *http.Client {
+	client := &http.Client{
+		Timeout: c.timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return errors.New("stopped after 10 redirects")
+			}
+			return c.checkHost(req.URL.Hostname())
+		},
+	}
+	if !c.blockPrivate {
+		return client
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip, err := netip.ParseAddr(host); err != nil || privateIP(ip) {
+				return fmt.Errorf(tr("Downloads from private address %s are blocked by -block-private-ips"), host)
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	// Through a proxy the dialer would only see the proxy's address, so
+	// sources are fetched directly and the address checked is theirs
+	transport.Proxy = nil
+	client.Transport = transport
+
+	return client
+}
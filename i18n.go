@@ -0,0 +1,77 @@
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+)
+
+// Message catalogs map English messages to their translation. New messages
+// are collected into them with `go run extract_messages.go <lang>`.
+//
+//go:embed locales/*.json
+var localeFiles embed.FS
+
+var messages map[string]string
+
+// setLanguage loads the catalog of lang, or of the language of the locale
+// environment when lang is empty. English needs no catalog.
+func setLanguage(lang string) error {
+	explicit := lang != ""
+	if !explicit {
+		lang = localeLanguage()
+	}
+	if lang == "" || lang == "en" {
+		return nil
+	}
+
+	data, err := localeFiles.ReadFile("locales/" + lang + ".json")
+	if err != nil {
+		if explicit {
+			return errors.New("No messages for language " + lang + ", expected one of " + languages())
+		}
+		// Untranslated locales fall back to English
+		return nil
+	}
+
+	return json.Unmarshal(data, &messages)
+}
+
+// localeLanguage returns the language of the locale from the environment,
+// e.g. de for LANG=de_DE.UTF-8
+func localeLanguage() string {
+	for _, name := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		if value := os.Getenv(name); value != "" {
+			lang, _, _ := strings.Cut(value, "_")
+			lang, _, _ = strings.Cut(lang, ".")
+			if lang == "C" || lang == "POSIX" {
+				return ""
+			}
+			return strings.ToLower(lang)
+		}
+	}
+
+	return ""
+}
+
+func languages() string {
+	names := []string{"en"}
+	entries, _ := localeFiles.ReadDir("locales")
+	for _, e := range entries {
+		names = append(names, strings.TrimSuffix(e.Name(), ".json"))
+	}
+
+	return strings.Join(names, ", ")
+}
+
+// tr translates a message, which may be a format string. Messages without a
+// translation stay in English.
+func tr(msg string) string {
+	if t, ok := messages[msg]; ok && t != "" {
+		return t
+	}
+
+	return msg
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+type imgurResponse struct {
+	Success bool
+	Data    imgurImage
+}
+
+// imgurImage is the data of an upload or album response
+type imgurImage struct {
+	ID         string
+	DeleteHash string
+	Link       string
+	Type       string
+	Width      int
+	Height     int
+	Size       int64
+	Err        imgurError `json:"error"`
+}
+
+// imgurError is the error of a failed request, which imgur sends either as
+// a string or as an object with a message
+type imgurError string
+
+func (e *imgurError) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*e = imgurError(s)
+		return nil
+	}
+
+	var obj struct {
+		Code    int
+		Message string
+		Type    string
+	}
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return err
+	}
+	msg := obj.Message
+	if obj.Type != "" {
+		msg += " (" + obj.Type + ")"
+	}
+	*e = imgurError(msg)
+
+	return nil
+}
+
+// decodeImgurResponse reads an API response, turning failed requests into
+// errors. Responses that are not JSON, such as the HTML error pages of
+// proxies, are reported by their HTTP status.
+func decodeImgurResponse(resp *http.Response) (*imgurResponse, error) {
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+
+	var imgur imgurResponse
+	err = json.Unmarshal(body, &imgur)
+	ok := resp.StatusCode >= 200 && resp.StatusCode < 300
+	switch {
+	case err != nil && ok:
+		return nil, errors.New("imgur error: invalid response: " + err.Error())
+	case err != nil:
+		return nil, errors.New("imgur error: " + resp.Status)
+	case !imgur.Success || !ok:
+		msg := string(imgur.Data.Err)
+		if msg == "" {
+			msg = resp.Status
+		}
+		return nil, errors.New("imgur error: " + msg)
+	}
+
+	return &imgur, nil
+}
+
+const imgurAlbumEndpoint = "https://api.imgur.com/3/album"
+
+// clientIDPool fails over between imgur client IDs, moving on to the next
+// one once imgur reports the current one as out of requests.
+type clientIDPool struct {
+	mu      sync.Mutex
+	ids     []string
+	current int
+}
+
+func newClientIDPool(list string) *clientIDPool {
+	p := &clientIDPool{}
+	for _, id := range strings.Split(list, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			p.ids = append(p.ids, id)
+		}
+	}
+
+	return p
+}
+
+// get returns the client ID to use, or false once every ID is exhausted
+func (p *clientIDPool) get() (string, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.current >= len(p.ids) {
+		return "", false
+	}
+
+	return p.ids[p.current], true
+}
+
+// record checks the rate limit state imgur returned for a request made with id
+func (p *clientIDPool) record(id string, status int, header http.Header) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.current >= len(p.ids) || p.ids[p.current] != id {
+		return
+	}
+
+	if status == http.StatusTooManyRequests || header.Get("X-RateLimit-ClientRemaining") == "0" {
+		p.current++
+	}
+}
+
+func (c *converter) uploadImgur() error {
+	clientID := strings.TrimSpace(c.clientID)
+	if clientID == "" {
+		c.warn(warnNoClientID, errors.New(tr("No imgur Client ID provided. File will be retained locally.")))
+		c.endImage = c.outputImage
+		return nil
+	}
+
+	// Prepare multi-part body
+	var b bytes.Buffer
+	w := multipart.NewWriter(&b)
+	f, err := os.Open(c.outputImage)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	// mp4 and webm outputs are uploaded as videos, shown on a .gifv page
+	field := "image"
+	if c.format != "gif" {
+		field = "video"
+	}
+	fw, err := w.CreateFormFile(field, filepath.Base(c.outputImage))
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(fw, f); err != nil {
+		return err
+	}
+	if c.keepName || c.nameTmpl != nil {
+		w.WriteField("name", filepath.Base(c.outputImage))
+	}
+	if title := c.uploadTitle(); title != "" {
+		w.WriteField("title", title)
+	}
+	w.Close()
+
+	client := &http.Client{
+		Timeout: c.timeout,
+	}
+
+	if id, ok := c.clientIDs.get(); ok && c.imgurPrecheck {
+		c.precheckImgur(client, id)
+	}
+
+	reauthorized := false
+	for {
+		clientID, ok := c.clientIDs.get()
+		if !ok {
+			return errors.New(tr("imgur error: all client IDs are rate limited"))
+		}
+
+		authorization, err := c.authorization(client, clientID)
+		if err != nil {
+			return err
+		}
+
+		status, err := c.postImage(client, clientID, authorization, b.Bytes(), w.FormDataContentType())
+		switch {
+		case status == http.StatusTooManyRequests:
+			continue
+		case status == http.StatusUnauthorized || status == http.StatusForbidden:
+			// An access token can be revoked before it expires, refresh once
+			if c.imgurAuth != nil && !reauthorized {
+				reauthorized = true
+				c.imgurAuth.expire()
+				continue
+			}
+		}
+
+		return err
+	}
+}
+
+// authorization returns the Authorization header for requests to imgur
+func (c *converter) authorization(client *http.Client, clientID string) (string, error) {
+	if c.imgurAuth == nil {
+		return "Client-ID " + clientID, nil
+	}
+
+	token, err := c.imgurAuth.token(client)
+	if err != nil {
+		return "", err
+	}
+
+	return "Bearer " + token, nil
+}
+
+// postImage uploads body and returns the HTTP status imgur responded with.
+// Rate limited responses are recorded against clientID.
+func (c *converter) postImage(client *http.Client, clientID, authorization string, body []byte, contentType string) (int, error) {
+	req, err := http.NewRequestWithContext(shutdownCtx, "POST", imgurAPIEndpoint, c.throttle(bytes.NewReader(body)))
+	if err != nil {
+		return 0, err
+	}
+	req.ContentLength = int64(len(body))
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Authorization", authorization)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	c.clientIDs.record(clientID, resp.StatusCode, resp.Header)
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return resp.StatusCode, nil
+	}
+
+	imgur, err := decodeImgurResponse(resp)
+	if err != nil {
+		return resp.StatusCode, err
+	}
+
+	c.endImage = imgur.Data.Link
+	c.imgurImage = &imgur.Data
+	if c.format != "gif" {
+		c.imgurPage = strings.TrimSuffix(c.endImage, path.Ext(c.endImage)) + ".gifv"
+	}
+
+	return resp.StatusCode, nil
+}
+
+// createAlbum collects the uploaded jobs into an album with the configured
+// privacy and returns its link. Anonymous uploads are added by delete hash.
+func (c *converter) createAlbum(jobs []*converter) (string, error) {
+	form := url.Values{"privacy": {c.privacy}}
+	for _, j := range jobs {
+		if c.imgurAuth != nil {
+			form.Add("ids[]", j.imgurImage.ID)
+		} else {
+			form.Add("deletehashes[]", j.imgurImage.DeleteHash)
+		}
+	}
+
+	client := &http.Client{
+		Timeout: c.timeout,
+	}
+
+	clientID, ok := c.clientIDs.get()
+	if !ok {
+		return "", errors.New(tr("imgur error: all client IDs are rate limited"))
+	}
+	authorization, err := c.authorization(client, clientID)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(shutdownCtx, "POST", imgurAlbumEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", authorization)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	imgur, err := decodeImgurResponse(resp)
+	if err != nil {
+		return "", err
+	}
+
+	return "https://imgur.com/a/" + imgur.Data.ID, nil
+}
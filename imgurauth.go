@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	imgurTokenEndpoint     = "https://api.imgur.com/oauth2/token"
+	imgurAuthorizeEndpoint = "https://api.imgur.com/oauth2/authorize"
+
+	keyringImgurClientSecret = "imgur-client-secret"
+	keyringImgurRefreshToken = "imgur-refresh-token"
+)
+
+var errRefreshTokenInvalid = errors.New("imgur refresh token is no longer valid")
+
+type imgurTokenResponse struct {
+	AccessToken     string `json:"access_token"`
+	RefreshToken    string `json:"refresh_token"`
+	ExpiresIn       int64  `json:"expires_in"`
+	AccountUsername string `json:"account_username"`
+}
+
+// imgurAuth uploads to an imgur account instead of anonymously. Access
+// tokens are refreshed as they expire and the refresh token is kept in the
+// OS keyring.
+type imgurAuth struct {
+	mu           sync.Mutex
+	clientID     string
+	clientSecret string
+	refreshToken string
+	accessToken  string
+	expires      time.Time
+	account      string
+}
+
+// loadImgurAuth returns the account whose client secret and refresh token
+// are stored in the keyring, for -imgur-account. Uploads never go to an
+// account just because its credentials are stored.
+func loadImgurAuth(clientIDs *clientIDPool) (*imgurAuth, error) {
+	clientID, ok := clientIDs.get()
+	if !ok {
+		return nil, errors.New("-imgur-account needs an imgur Client ID, set it with -c or go-gif-pr auth set " + keyringImgurClientID)
+	}
+
+	secret, err := keyringGet(keyringImgurClientSecret)
+	if err != nil {
+		return nil, errors.New("-imgur-account needs the client secret of the application, run: go-gif-pr auth set " + keyringImgurClientSecret)
+	}
+	refreshToken, err := keyringGet(keyringImgurRefreshToken)
+	if err != nil {
+		return nil, errors.New("-imgur-account needs a refresh token of the account, run: go-gif-pr auth set " + keyringImgurRefreshToken)
+	}
+
+	return &imgurAuth{
+		clientID:     clientID,
+		clientSecret: secret,
+		refreshToken: refreshToken,
+	}, nil
+}
+
+// token returns a valid access token, refreshing it if it has expired. The
+// user is only asked to authorize again if the refresh token is rejected.
+func (a *imgurAuth) token(client *http.Client) (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.accessToken != "" && time.Now().Before(a.expires) {
+		return a.accessToken, nil
+	}
+
+	err := a.refresh(client)
+	if err == errRefreshTokenInvalid {
+		err = a.reauthorize()
+		if err != nil {
+			return "", err
+		}
+		err = a.refresh(client)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return a.accessToken, nil
+}
+
+// expire forces the next call to token to refresh the access token
+func (a *imgurAuth) expire() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.accessToken = ""
+}
+
+func (a *imgurAuth) refresh(client *http.Client) error {
+	form := url.Values{
+		"refresh_token": {a.refreshToken},
+		"client_id":     {a.clientID},
+		"client_secret": {a.clientSecret},
+		"grant_type":    {"refresh_token"},
+	}
+
+	resp, err := client.PostForm(imgurTokenEndpoint, form)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusUnauthorized {
+		return errRefreshTokenInvalid
+	}
+	if resp.StatusCode != http.StatusOK {
+		return errors.New("imgur token refresh failed: " + resp.Status)
+	}
+
+	var token imgurTokenResponse
+	err = json.NewDecoder(resp.Body).Decode(&token)
+	if err != nil {
+		return err
+	}
+
+	a.accessToken = token.AccessToken
+	// Refresh a minute early so a token never expires mid upload
+	a.expires = time.Now().Add(time.Duration(token.ExpiresIn)*time.Second - time.Minute)
+	// Say whose account the uploads go to, again if a new token changed it
+	if token.AccountUsername != "" && token.AccountUsername != a.account {
+		a.account = token.AccountUsername
+		stage("imgur", fmt.Sprintf(tr("uploading to the account of %s"), a.account))
+	}
+
+	if token.RefreshToken != "" && token.RefreshToken != a.refreshToken {
+		a.refreshToken = token.RefreshToken
+		err = keyringSet(keyringImgurRefreshToken, a.refreshToken)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Could not store new imgur refresh token:", err)
+		}
+	}
+
+	return nil
+}
+
+// reauthorize asks the user for a new refresh token when running
+// interactively, so a batch can continue instead of failing part way.
+func (a *imgurAuth) reauthorize() error {
+	if !isTerminal(os.Stdin) {
+		return errors.New(errRefreshTokenInvalid.Error() + ", run: go-gif-pr auth set " + keyringImgurRefreshToken)
+	}
+
+	fmt.Fprintln(os.Stderr, errRefreshTokenInvalid.Error()+". Authorize again at:")
+	fmt.Fprintln(os.Stderr, imgurAuthorizeEndpoint+"?client_id="+url.QueryEscape(a.clientID)+"&response_type=token")
+	fmt.Fprint(os.Stderr, "and paste the refresh_token from the redirect URL: ")
+
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return err
+	}
+	refreshToken := strings.TrimSpace(line)
+	if refreshToken == "" {
+		return errRefreshTokenInvalid
+	}
+
+	a.refreshToken = refreshToken
+	return keyringSet(keyringImgurRefreshToken, refreshToken)
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+
+	return info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Limits of imgur uploads besides the file size. imgur does not publish
+// them through its API, so they are kept here. Every upload costs
+// imgurUploadCredits of the hourly request credits.
+const (
+	imgurVideoDuration = 60 * time.Second
+	imgurUploadCredits = 10
+	imgurCreditsLow    = 10 * imgurUploadCredits
+
+	imgurCreditsEndpoint = "https://api.imgur.com/3/credits"
+)
+
+type imgurCredits struct {
+	UserRemaining   int
+	UserReset       int64
+	ClientRemaining int
+}
+
+// Credits are looked up once per run, before the first upload
+var imgurCreditCheck sync.Once
+
+// precheckImgur warns about the likely reasons imgur would reject or alter
+// an upload, before it is attempted. It never stops the upload.
+func (c *converter) precheckImgur(client *http.Client, clientID string) {
+	duration := c.expectedDuration()
+	if c.format != "gif" && duration > imgurVideoDuration {
+		c.warn(warnImgurDuration, fmt.Errorf(tr("%s is %s long; imgur rejects videos over %s, use -trim to shorten it"), c.outputImage, duration.Round(time.Second), imgurVideoDuration))
+	}
+	if c.format == "gif" && c.keepAudio {
+		c.warn(warnImgurAudio, fmt.Errorf(tr("%s is a GIF; imgur only keeps audio of mp4 and webm uploads"), c.outputImage))
+	}
+
+	imgurCreditCheck.Do(func() {
+		if c.waitLookup(imgurCreditsEndpoint) != nil {
+			return
+		}
+		// With an account active the credits are those of the account
+		var credits *imgurCredits
+		authorization, err := c.authorization(client, clientID)
+		if err == nil {
+			credits, err = fetchImgurCredits(client, authorization)
+		}
+		if err != nil {
+			c.warn(warnImgurCredits, fmt.Errorf(tr("Could not check the imgur credits: %v"), err))
+			return
+		}
+		remaining := min(credits.UserRemaining, credits.ClientRemaining)
+		if remaining < imgurCreditsLow {
+			c.warn(warnImgurCredits, fmt.Errorf(tr("Only %d imgur uploads are left until %s; later uploads will be rate limited"),
+				remaining/imgurUploadCredits, time.Unix(credits.UserReset, 0).Format("15:04")))
+		}
+	})
+}
+
+func fetchImgurCredits(client *http.Client, authorization string) (*imgurCredits, error) {
+	req, err := http.NewRequestWithContext(shutdownCtx, "GET", imgurCreditsEndpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", authorization)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var credits struct {
+		Data imgurCredits
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("imgur returned %s", resp.Status)
+	}
+	err = json.NewDecoder(resp.Body).Decode(&credits)
+	if err != nil {
+		return nil, err
+	}
+
+	return &credits.Data, nil
+}
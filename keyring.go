@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	keyringService = "go-gifv-pr"
+
+	// Names of the secrets read from the keyring
+	keyringImgurClientID = "imgur-client-id"
+)
+
+var errSecretNotFound = errors.New("Secret not found in keyring")
+
+func authCommand(args []string) error {
+	usage := errors.New("Usage: go-gif-pr auth set|get|delete <name> [value]")
+	if len(args) < 2 {
+		return usage
+	}
+	name := args[1]
+
+	switch args[0] {
+	case "set":
+		var value string
+		if len(args) > 2 {
+			value = args[2]
+		} else {
+			// Reading from stdin keeps the secret out of shell history
+			fmt.Fprint(os.Stderr, "Value for "+name+": ")
+			line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+			if err != nil && line == "" {
+				return err
+			}
+			value = strings.TrimSpace(line)
+		}
+		if value == "" {
+			return errors.New("Refusing to store an empty value for " + name)
+		}
+		return keyringSet(name, value)
+	case "get":
+		value, err := keyringGet(name)
+		if err != nil {
+			return err
+		}
+		fmt.Println(value)
+		return nil
+	case "delete":
+		return keyringDelete(name)
+	}
+
+	return usage
+}
+
+// secretOrKeyring returns value if set, otherwise the named keyring secret
+func secretOrKeyring(value, name string) string {
+	if strings.TrimSpace(value) != "" {
+		return value
+	}
+
+	secret, err := keyringGet(name)
+	if err != nil {
+		return value
+	}
+
+	return secret
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os/exec"
+	"strings"
+)
+
+// The macOS keychain is managed through the security command line tool
+
+// keyringSet sends the command to an interactive security session on its
+// stdin, so the secret never appears in the arguments other users can see
+// with ps. A -w without a value would prompt on the terminal instead.
+func keyringSet(name, value string) error {
+	command := "add-generic-password -U -s " + securityQuote(keyringService) + " -a " + securityQuote(name) + " -w " + securityQuote(value) + "\n"
+	cmd := exec.Command("security", "-i")
+	cmd.Stdin = strings.NewReader(command)
+
+	// The session exits cleanly after a failed command, which it only
+	// reports on stderr
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if err != nil || strings.TrimSpace(stderr.String()) != "" {
+		return errors.New("keychain error: " + strings.TrimSpace(stderr.String()))
+	}
+
+	return nil
+}
+
+// securityQuote quotes an argument for the command parser of security -i
+func securityQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+func keyringGet(name string) (string, error) {
+	out, err := exec.Command("security", "find-generic-password", "-s", keyringService, "-a", name, "-w").Output()
+	if err != nil {
+		return "", errSecretNotFound
+	}
+
+	return strings.TrimRight(string(out), "\n"), nil
+}
+
+func keyringDelete(name string) error {
+	return runSecurity("delete-generic-password", "-s", keyringService, "-a", name)
+}
+
+func runSecurity(args ...string) error {
+	cmd := exec.Command("security", args...)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if err != nil {
+		return errors.New("keychain error: " + strings.TrimSpace(stderr.String()))
+	}
+
+	return nil
+}
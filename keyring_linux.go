@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os/exec"
+	"strings"
+)
+
+// The Secret Service (GNOME Keyring, KWallet) is managed through secret-tool
+
+func keyringSet(name, value string) error {
+	cmd := exec.Command("secret-tool", "store", "--label="+keyringService+" "+name, "service", keyringService, "account", name)
+	cmd.Stdin = strings.NewReader(value)
+
+	return runSecretTool(cmd)
+}
+
+func keyringGet(name string) (string, error) {
+	out, err := exec.Command("secret-tool", "lookup", "service", keyringService, "account", name).Output()
+	if err != nil || len(out) == 0 {
+		return "", errSecretNotFound
+	}
+
+	return strings.TrimRight(string(out), "\n"), nil
+}
+
+func keyringDelete(name string) error {
+	return runSecretTool(exec.Command("secret-tool", "clear", "service", keyringService, "account", name))
+}
+
+func runSecretTool(cmd *exec.Cmd) error {
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if err != nil {
+		return errors.New("keyring error: " + strings.TrimSpace(stderr.String()+" "+err.Error()))
+	}
+
+	return nil
+}
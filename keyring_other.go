@@ -0,0 +1,19 @@
+//go:build !darwin && !linux && !windows
+
+package main
+
+import "errors"
+
+var errKeyringUnsupported = errors.New("No OS keyring support on this platform")
+
+func keyringSet(name, value string) error {
+	return errKeyringUnsupported
+}
+
+func keyringGet(name string) (string, error) {
+	return "", errKeyringUnsupported
+}
+
+func keyringDelete(name string) error {
+	return errKeyringUnsupported
+}
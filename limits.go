@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Default file size limits of the upload targets. Jira and Confluence
+// administrators can change theirs, which -upload-limit overrides.
+const (
+	imgurAnimatedLimit  = 200 << 20
+	githubAssetLimit    = 2 << 30
+	githubContentLimit  = 100 << 20
+	jiraAttachmentLimit = 10 << 20
+	confluenceLimit     = 100 << 20
+)
+
+// uploadLimit returns the largest file the upload target accepts, or zero
+// when it is unknown
+func (c *converter) uploadLimit() int64 {
+	if c.uploadMax > 0 {
+		return int64(c.uploadMax)
+	}
+	if !c.uploadEnabled() {
+		return 0
+	}
+
+	switch c.uploader {
+	case "imgur":
+		return imgurAnimatedLimit
+	case "github":
+		if c.githubRelease != "" {
+			return githubAssetLimit
+		}
+		return githubContentLimit
+	case "jira":
+		return jiraAttachmentLimit
+	case "confluence":
+		return confluenceLimit
+	}
+
+	return 0
+}
+
+// limitPreset lowers the frame rate and quality of an output in steps until
+// it fits the upload limit, keeping its size and format
+func limitPreset(uploader, format string, limit int64) *outputPreset {
+	p := &outputPreset{
+		name:    uploader + " upload",
+		format:  format,
+		maxSize: limit,
+	}
+
+	switch format {
+	case "gif":
+		p.tunings = []presetTuning{
+			{frameRate: 15},
+			{frameRate: 12, colors: 128},
+			{frameRate: 10, colors: 64},
+			{frameRate: 8, colors: 32},
+		}
+	default:
+		p.tunings = []presetTuning{
+			{frameRate: 30, crf: 28},
+			{frameRate: 24, crf: 33},
+			{frameRate: 20, crf: 38},
+			{frameRate: 15, crf: 43},
+		}
+	}
+
+	return p
+}
+
+func (c *converter) validateLimit() error {
+	switch c.onLimit {
+	case "warn", "retune", "ignore":
+	default:
+		return errors.New("-on-limit must be warn, retune or ignore")
+	}
+
+	return nil
+}
+
+// checkUploadLimit is called before uploading. Outputs over the limit are
+// kept locally with a warning instead of attempting an upload that would be
+// rejected, unless the limit is ignored.
+func (c *converter) checkUploadLimit() bool {
+	limit := c.uploadLimit()
+	size := fileSize(c.outputImage)
+	if c.onLimit == "ignore" || limit == 0 || size <= limit {
+		return true
+	}
+
+	c.warn(warnUploadLimit, fmt.Errorf(tr("Not uploading %s: it is %dKB, over the %dKB %s upload limit. Use -on-limit retune to shrink it or -upload-limit if the limit was raised."),
+		c.outputImage, size>>10, limit>>10, c.uploader))
+	return false
+}
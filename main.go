@@ -1,258 +1,1212 @@
 package main
 
 import (
-	"bytes"
 	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
-	"mime/multipart"
 	"net/http"
 	"net/url"
 	"os"
-	"os/exec"
 	"path"
+	"path/filepath"
+	"runtime"
+	"strconv"
 	"strings"
+	"text/template"
 	"time"
 )
 
 type converter struct {
 	keepFiles      bool
+	noUpload       bool
+	outputJSON     bool
+	keepName       bool
+	assetName      string
+	trim           string
+	caption        string
+	format         string
+	keepAudio      bool
+	mute           bool
+	noAutorotate   bool
+	noTonemap      bool
+	stillDuration  time.Duration
+	device         string
+	captureLength  time.Duration
+	zoom           float64
+	pan            string
+	audiogram      string
+	background     string
+	waveColor      string
+	presetName     string
+	preset         *outputPreset
+	tuning         int
+	speed          float64
+	interpolate    int
+	frameRange     string
+	holdFirst      time.Duration
+	holdLast       time.Duration
+	loopCrossfade  time.Duration
+	titleCard      string
+	endCard        string
+	cardDuration   time.Duration
+	progressBar    bool
+	progressColor  string
+	blurRegions    regionList
+	aspect         string
+	gravity        string
+	aspectFit      string
+	stabilize      bool
+	textMode       bool
+	quantizer      string
+	forceReencode  bool
+	unchanged      bool
+	mirror         bool
+	mirrorTitle    string
+	migration      *historyEntry
+	warnings       []warning
+	widthSet       bool
+	transforms     string
+	autoCrop       bool
+	crop           *cropRegion
+	dryRun         bool
+	sharedPalette  bool
+	palette        string
+	shortcodeStyle string
+	uploadMax      byteSize
+	onLimit        string
+	fallback       string
+	maxSize        byteSize
+	frameDelay     string
+	optimizeJobs   int
+	threadCount    int
+	optimizer      string
+	keepSource     bool
+	decoder        string
+	fsync          bool
+	noCache        bool
+	previewFirst   bool
+	workspace      string
+	resumed        string
+	recoverMode    string
+	workDir        string
+	timings        stageTimings
+	alt            string
+	altCmd         string
+	showTimings    bool
+	allowHosts     string
+	denyHosts      string
+	blockPrivate   bool
+	urlRewrites    rewriteList
+	tags           tagList
+	noHistory      bool
+	finished       chan struct{}
+	nameTemplate   string
+	nameTmpl       *template.Template
 	outputMarkdown bool
 	imageWidth     string
+	widthList      string
+	widths         []string
 	clientID       string
+	uploader       string
+	clientIDs      *clientIDPool
+	imgurAuth      *imgurAuth
+	imgurAccount   bool
+	privacy        string
+	imgurPrecheck  bool
+	githubToken    string
+	githubRepo     string
+	githubRelease  string
+	githubPath     string
+	githubBranch   string
+	atlassianURL   string
+	atlassianUser  string
+	atlassianToken string
+	jiraIssue      string
+	confluencePage string
+	limitRate      byteRate
+	timeout        time.Duration
+	resolveEvery   time.Duration
+	preConvertCmd  string
+	postConvertCmd string
+	postUploadCmd  string
+
+	imgurImage *imgurImage
+	// imgurPage is the .gifv page of a video uploaded to imgur
+	imgurPage string
 
 	startImage    string
 	fileToConvert string
 	outputImage   string
 	endImage      string
-}
 
-type imgurResponse struct {
-	Success bool
-	Data    struct {
-		Link string
-		Err  string `json:"error"`
-	}
+	index    int
+	meta     *mediaInfo
+	variants []*converter
+
+	sourceSize int64
+	outputSize int64
+	duration   time.Duration
+	err        error
 }
 
 const (
 	tempFileName     = "temp_file_to_convert"
 	outputFileName   = "output"
+	captionFileName  = "temp_caption"
+	paletteFileName  = "temp_palette.png"
 	imgurAPIEndpoint = "https://api.imgur.com/3/image"
 )
 
+// Environment variables for the original single letter flags. Any other flag
+// maps to GIFV_ followed by its upper cased name.
+var flagEnvNames = map[string]string{
+	"i": "GIFV_INPUT",
+	"w": "GIFV_WIDTH",
+	"c": "GIFV_CLIENT_ID",
+	"k": "GIFV_KEEP_FILES",
+	"m": "GIFV_MARKDOWN",
+}
+
+// Subcommands handled instead of a conversion when given as the first argument
+var subcommands = map[string]func(args []string) error{
+	"self-update": selfUpdate,
+	"auth":        authCommand,
+	"probe":       probeCommand,
+	"analyze":     analyzeCommand,
+	"version":     versionCommand,
+	"history":     historyCommand,
+}
+
 func main() {
+	os.Exit(run())
+}
+
+// run returns the exit status, which is non-zero if any input failed. Only
+// results are written to stdout so the output can be captured by scripts.
+func run() int {
+	// Mirror and migrate take the conversion flags for their uploads
+	args := os.Args[1:]
+	var command string
+	if len(args) > 0 && (args[0] == "mirror" || args[0] == "migrate") {
+		command, args = args[0], args[1:]
+	} else if len(args) > 0 {
+		if cmd, ok := subcommands[args[0]]; ok {
+			err := cmd(args[1:])
+			if err != nil {
+				printError(err)
+				return 1
+			}
+			return 0
+		}
+	}
+
 	var conv converter
+	var archivePath, galleryDir, reportPath, manifestPath, assetsPath, siteDataPath, feedURL, scheduleSpec string
+	var scheduleJitter time.Duration
+	var noColor bool
+	var language string
+	var grace time.Duration
+	var pendingPath string
+	var migrateTo string
 
+	if command == "migrate" {
+		flag.StringVar(&migrateTo, "to", "", "Uploader to move the outputs in the history to, e.g. github or an uploader plugin name.")
+	}
 	flag.StringVar(&conv.startImage, "i", "", "URL or path of the .gifv or video to convert")
 	flag.StringVar(&conv.imageWidth, "w", "300", "Width of the final converted image. Defaults to 300.")
-	flag.StringVar(&conv.clientID, "c", os.Getenv("IMGUR_CLIENT_ID"), "Imgur Client ID. Defaults to ENV var IMGUR_CLIENT_ID")
+	flag.StringVar(&conv.widthList, "widths", "", "Comma separated widths to produce from a single decode, e.g. 240,480,720.")
+	flag.StringVar(&conv.clientID, "c", os.Getenv("IMGUR_CLIENT_ID"), "Imgur Client ID, or a comma separated list to rotate through. Defaults to ENV var IMGUR_CLIENT_ID")
+	flag.StringVar(&conv.device, "device", "", "Record the input from a camera, e.g. /dev/video0 on Linux, 0 on macOS or the device name on Windows.")
+	flag.DurationVar(&conv.captureLength, "capture-duration", 5*time.Second, "How long to record from -device.")
 	flag.BoolVar(&conv.keepFiles, "k", false, "Option to keep intermediary files created during conversion.")
+	flag.BoolVar(&conv.keepSource, "keep-source", false, "Keep the downloaded source of each job.")
+	flag.BoolVar(&conv.noCache, "no-cache", false, "Download remote sources again instead of revalidating the copy in the download cache.")
+	flag.StringVar(&conv.recoverMode, "recover", "", "What to do with the workspaces of crashed runs: resume their jobs without downloading again, retry them, or clean them up.")
+	flag.StringVar(&conv.workDir, "work-dir", "", "Directory for downloaded sources, intermediary files and outputs, created if missing. Defaults to the current directory.")
+	flag.BoolVar(&conv.fsync, "fsync", false, "Flush each output to disk before renaming it into place, for network shares.")
 	flag.BoolVar(&conv.outputMarkdown, "m", false, "Output Markdown formatted text for quick copy/paste.")
-	flag.Parse()
+	flag.StringVar(&conv.alt, "alt", "", "Alt text describing the result, used in Markdown, img tags, shortcodes and site data.")
+	flag.StringVar(&conv.altCmd, "alt-cmd", "", "Shell command suggesting alt text when -alt is not given. It gets the first frame as a PNG in GIFV_FILE and prints the description.")
+	flag.StringVar(&conv.shortcodeStyle, "shortcode", "", "Print a hugo or jekyll snippet embedding the result instead of the link.")
+	flag.BoolVar(&conv.noUpload, "no-upload", false, "Convert locally only and never upload.")
+	flag.BoolVar(&conv.outputJSON, "json", false, "Print one JSON object per result instead of links.")
+	flag.BoolVar(&conv.keepName, "keep-name", false, "Name the output after the source file and use it as the imgur name/title.")
+	flag.StringVar(&conv.trim, "trim", "", "Only convert this part of the source, as START-END in seconds or [HH:]MM:SS, e.g. 2-6.5. Either end may be omitted.")
+	flag.StringVar(&conv.frameDelay, "frame-delay", "", "Set the delay of output GIF frames, as RANGE:DELAY items, e.g. 0-10:100ms,last:2s.")
+	flag.StringVar(&conv.frameRange, "frames", "", "Only convert this range of frame numbers, as START:END, e.g. 120:300. Either end may be omitted.")
+	flag.DurationVar(&conv.holdFirst, "hold-first", 0, "Show the first frame this much longer, e.g. 1s.")
+	flag.DurationVar(&conv.holdLast, "hold-last", 0, "Show the last frame this much longer so loops pause on the end state, e.g. 2s.")
+	flag.DurationVar(&conv.loopCrossfade, "loop-crossfade", 0, "Blend this much of the end of the clip into its start so it loops seamlessly, e.g. 0.5s.")
+	flag.StringVar(&conv.titleCard, "title-card", "", "Text of a card shown before the clip.")
+	flag.StringVar(&conv.endCard, "end-card", "", "Text of a card shown after the clip.")
+	flag.DurationVar(&conv.cardDuration, "card-duration", 1500*time.Millisecond, "How long the title and end cards are shown.")
+	flag.BoolVar(&conv.progressBar, "progress-overlay", false, "Draw a bar along the bottom of the output that shows how far the loop has played.")
+	flag.StringVar(&conv.progressColor, "progress-color", "white@0.8", "Color of the -progress-overlay bar.")
+	flag.Var(&conv.blurRegions, "blur-region", "Pixelate an area of the source, as X,Y,WxH with an optional ,START-END time range. May be repeated.")
+	flag.StringVar(&conv.aspect, "aspect", "", "Crop the output to an aspect ratio such as 1:1, 9:16 or 16:9.")
+	flag.StringVar(&conv.gravity, "gravity", "center", "Part of the frame kept by -aspect: center, north, south, east or west.")
+	flag.StringVar(&conv.aspectFit, "aspect-fit", "crop", "How -aspect changes the frame: crop, or pad with black bars.")
+	flag.BoolVar(&conv.stabilize, "stabilize", false, "Smooth out camera shake of handheld clips before scaling.")
+	flag.BoolVar(&conv.forceReencode, "force-reencode", false, "Convert GIF sources with ffmpeg even when no option changes their frames.")
+	flag.StringVar(&conv.quantizer, "quantizer", "", "How GIF colors are chosen: palettegen (ffmpeg, one palette per output), mediancut (built in) or gifski (per frame palettes, needs gifski).")
+	flag.BoolVar(&conv.textMode, "text-mode", false, "Scale and map colors to keep small text legible, for terminal and editor recordings.")
+	flag.BoolVar(&conv.autoCrop, "auto-crop", false, "Crop the output to the area of the source that changes, cutting static margins.")
+	flag.BoolVar(&conv.previewFirst, "preview-first", false, "Show a small, low frame rate preview of each input and ask before converting it at full quality.")
+	flag.BoolVar(&conv.dryRun, "dry-run", false, "Fetch and analyze the inputs without converting them, printing the -auto-crop region.")
+	flag.BoolVar(&conv.sharedPalette, "shared-palette", false, "Generate one GIF palette from all inputs and use it for every output, for a consistent look across a batch.")
+	flag.StringVar(&conv.caption, "caption", "", "Text to burn into the bottom of the output.")
+	flag.StringVar(&conv.format, "format", "gif", "Output format: gif, mp4 or webm.")
+	flag.StringVar(&conv.presetName, "preset", "", "Fit the output to a platform's limits: "+presetNames()+". Overrides -format and -w.")
+	flag.Float64Var(&conv.speed, "speed", 1, "Playback speed of the output, e.g. 2 for twice as fast or 0.5 for slow motion.")
+	flag.IntVar(&conv.interpolate, "interpolate", 0, "Synthesize intermediate frames up to this frame rate, e.g. 60, so slow motion stays smooth.")
+	flag.BoolVar(&conv.keepAudio, "keep-audio", false, "Keep the audio track in mp4 and webm outputs.")
+	flag.BoolVar(&conv.mute, "mute", false, "Strip the audio track from mp4 and webm outputs.")
+	flag.BoolVar(&conv.noAutorotate, "no-autorotate", false, "Ignore rotation metadata and convert the frames as stored.")
+	flag.BoolVar(&conv.noTonemap, "no-tonemap", false, "Do not tone map HDR sources to SDR.")
+	flag.DurationVar(&conv.stillDuration, "still-duration", 5*time.Second, "Length of the animation generated from a still image.")
+	flag.Float64Var(&conv.zoom, "zoom", 1.3, "How far to zoom into a still image over the animation. 1 disables zooming.")
+	flag.StringVar(&conv.pan, "pan", "center", "Direction to pan across a still image while zooming: center, left, right, up or down.")
+	flag.StringVar(&conv.audiogram, "audiogram", "waves", "Visualization rendered for audio sources: waves or spectrum.")
+	flag.StringVar(&conv.background, "background", "", "Image to show behind the visualization of audio sources.")
+	flag.StringVar(&conv.waveColor, "wave-color", "white", "Color of the waveform drawn for audio sources.")
+	flag.StringVar(&conv.nameTemplate, "name-template", "", "Template for the output file name, e.g. {{.Title}}-{{.Date}}. Fields: Name, Title, Date, Created.")
+	flag.StringVar(&conv.uploader, "uploader", "imgur", "Where to upload the result: imgur, github, jira, confluence or an uploader plugin name.")
+	flag.StringVar(&conv.githubToken, "github-token", os.Getenv("GITHUB_TOKEN"), "GitHub token for the github uploader. Defaults to ENV var GITHUB_TOKEN.")
+	flag.StringVar(&conv.githubRepo, "github-repo", "", "Repository (owner/repo) the github uploader writes to.")
+	flag.StringVar(&conv.githubRelease, "github-release", "", "Release tag to attach the result to as an asset.")
+	flag.StringVar(&conv.githubPath, "github-path", "", "Directory in the repository to commit the result to when no release is given.")
+	flag.StringVar(&conv.githubBranch, "github-branch", "", "Branch to commit to. Defaults to the repository's default branch.")
+	flag.StringVar(&conv.atlassianURL, "atlassian-url", "", "Base URL of the Jira or Confluence site, e.g. https://example.atlassian.net.")
+	flag.StringVar(&conv.atlassianUser, "atlassian-user", "", "Atlassian account email for the jira and confluence uploaders.")
+	flag.StringVar(&conv.atlassianToken, "atlassian-token", os.Getenv("ATLASSIAN_API_TOKEN"), "Atlassian API token. Defaults to ENV var ATLASSIAN_API_TOKEN.")
+	flag.StringVar(&conv.jiraIssue, "jira-issue", "", "Jira issue key to attach the result to.")
+	flag.StringVar(&conv.confluencePage, "confluence-page", "", "Confluence page ID to attach the result to.")
+	flag.BoolVar(&conv.imgurAccount, "imgur-account", false, "Upload to the imgur account whose client secret and refresh token are stored with go-gif-pr auth, instead of anonymously.")
+	flag.BoolVar(&conv.imgurPrecheck, "imgur-precheck", false, "Warn about the likely reasons imgur would reject an upload, and about running out of request credits, before uploading.")
+	flag.StringVar(&conv.privacy, "privacy", "", "Add uploads to an imgur album with this privacy: public, hidden or secret. Imgur only has a mature flag for gallery posts, so use hidden or secret for NSFW content.")
+	flag.StringVar(&conv.fallback, "fallback", "", "Convert GIFs over the size budget to this format instead: mp4 or webm.")
+	flag.Var(&conv.maxSize, "max-size", "Size budget of -fallback, e.g. 5MB. Defaults to the upload limit.")
+	flag.Var(&conv.uploadMax, "upload-limit", "Largest file the upload target accepts, e.g. 25MB. Defaults to the known limit of the uploader.")
+	flag.StringVar(&conv.onLimit, "on-limit", "warn", "What to do with outputs over the upload limit: warn and keep them locally, retune them to fit, or ignore the limit.")
+	flag.Var(&conv.urlRewrites, "url-rewrite", "Rewrite the start of uploaded links, as FROM=>TO, e.g. https://i.imgur.com=>https://img.example.com. May be repeated.")
+	flag.StringVar(&conv.allowHosts, "allow-hosts", "", "Only download sources from these comma separated hosts and their subdomains.")
+	flag.StringVar(&conv.denyHosts, "deny-hosts", "", "Never download sources from these comma separated hosts and their subdomains.")
+	flag.BoolVar(&conv.blockPrivate, "block-private-ips", false, "Refuse to download sources from loopback, private, link-local and carrier-grade NAT addresses.")
+	flag.Var(&conv.limitRate, "limit-rate", "Limit download and upload bandwidth, shared by all transfers running at once, e.g. 500KB/s or 2MB/s.")
+	flag.DurationVar(&conv.timeout, "timeout", 10*time.Second, "Timeout for each download and upload.")
+	flag.DurationVar(&conv.resolveEvery, "resolve-interval", time.Second, "Minimum time between lookups on the same host, by resolvers, resolver plugins and imgur's API outside of uploads.")
+	flag.StringVar(&conv.preConvertCmd, "pre-convert-cmd", "", "Shell command to run on each downloaded source before it is converted.")
+	flag.StringVar(&conv.postConvertCmd, "post-convert-cmd", "", "Shell command to run on each converted file before it is uploaded.")
+	flag.StringVar(&conv.postUploadCmd, "post-upload-cmd", "", "Shell command to run after each upload, with the URL in GIFV_URL.")
+	flag.StringVar(&conv.optimizer, "optimizer", "auto", "GIF optimizer: gifsicle, builtin, or auto to use gifsicle when it is installed.")
+	flag.IntVar(&conv.optimizeJobs, "optimize-jobs", runtime.NumCPU(), "Number of gifsicle optimizations to run at once.")
+	flag.IntVar(&conv.threadCount, "threads", 0, "Threads each ffmpeg process may use. Defaults to the CPU count, halved when optimizations run alongside conversions.")
+	flag.BoolVar(&conv.showTimings, "timings", false, "Print the time spent fetching, converting, optimizing and uploading after the batch.")
+	flag.StringVar(&language, "lang", "", "Language of messages, e.g. de. Defaults to the language of the locale (LC_ALL, LC_MESSAGES or LANG).")
+	flag.BoolVar(&noColor, "no-color", false, "Disable colored output. Colors are also disabled by NO_COLOR and when not writing to a terminal.")
+	flag.DurationVar(&grace, "grace", 30*time.Second, "How long running jobs may take to finish after SIGINT/SIGTERM before they are cancelled.")
+	flag.StringVar(&pendingPath, "pending-file", "", "After a shutdown, write the sources that were not started to this file.")
+	flag.StringVar(&scheduleSpec, "schedule", "", "Keep running and convert the new entries of -feed or -assets-dir on this cron schedule, e.g. \"*/30 * * * *\".")
+	flag.DurationVar(&scheduleJitter, "schedule-jitter", 0, "Delay each scheduled run by a random time up to this long, e.g. 2m.")
+	flag.StringVar(&feedURL, "feed", "", "Convert the media of the RSS or Atom feed entries that are new since the last run.")
+	flag.StringVar(&manifestPath, "manifest", "", "YAML file listing the inputs to convert, each with optional source, trim, width, caption and uploader overrides.")
+	flag.StringVar(&assetsPath, "assets-dir", "", "Convert the new and changed media files in this directory and keep a map of their URLs in it.")
+	flag.StringVar(&siteDataPath, "site-data", "", "Add the results to this Hugo or Jekyll data file (.json, or YAML otherwise).")
+	flag.StringVar(&archivePath, "archive", "", "Bundle the converted files and a manifest of their URLs into this .zip file.")
+	flag.StringVar(&galleryDir, "gallery", "", "Write an index.html gallery of the converted files into this directory.")
+	flag.Var(&conv.tags, "tag", "Label the conversions in the history, e.g. release-1.4. May be repeated.")
+	flag.BoolVar(&conv.noHistory, "no-history", false, "Do not record the conversions in the history.")
+	flag.StringVar(&reportPath, "report", "", "Write a per-input report to this .csv or .json file.")
 
-	err := conv.validate()
+	// Environment variables provide defaults, command line flags take precedence
+	err := applyFlagEnv(flag.CommandLine)
 	if err != nil {
-		fmt.Println(err)
-		return
+		printError(err)
+		return 1
 	}
+	flag.CommandLine.Parse(args)
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "w" || f.Name == "widths" {
+			conv.widthSet = true
+		}
+	})
+	setupColor(noColor)
+	err = setLanguage(language)
+	if err != nil {
+		printError(err)
+		return 1
+	}
+	setupStatusLine()
 
-	defer conv.cleanup()
+	if command == "migrate" {
+		if migrateTo == "" {
+			printError(errors.New("migrate needs the uploader to move the history to, e.g. go-gif-pr migrate -to github"))
+			return 1
+		}
+		if flag.NArg() > 0 {
+			printError(errors.New("migrate takes its outputs from the history, not from arguments"))
+			return 1
+		}
+		conv.uploader = migrateTo
+	}
 
-	err = conv.fetchFile()
-	if err != nil {
-		fmt.Println(err)
-		return
+	conv.clientID = secretOrKeyring(conv.clientID, keyringImgurClientID)
+	conv.githubToken = secretOrKeyring(conv.githubToken, keyringGitHubToken)
+	conv.atlassianToken = secretOrKeyring(conv.atlassianToken, keyringAtlassianToken)
+	conv.clientIDs = newClientIDPool(conv.clientID)
+	if conv.imgurAccount {
+		conv.imgurAuth, err = loadImgurAuth(conv.clientIDs)
+		if err != nil {
+			printError(err)
+			return 1
+		}
 	}
 
-	err = conv.convert()
+	if scheduleSpec != "" && feedURL == "" && assetsPath == "" {
+		printError(errors.New("-schedule needs -feed or -assets-dir, whose new entries each run converts"))
+		return 1
+	}
+	var schedule *cronSchedule
+	if scheduleSpec != "" {
+		schedule, err = parseSchedule(scheduleSpec)
+		if err != nil {
+			printError(err)
+			return 1
+		}
+	}
+	err = conv.validateRecover()
 	if err != nil {
-		fmt.Println(err)
-		return
+		printError(err)
+		return 1
 	}
-
-	err = conv.upload()
+	recovered, err := recoverWorkspaces(&conv)
 	if err != nil {
-		fmt.Println(err)
-		return
+		printError(err)
+		return 1
 	}
+	watchSignals(grace)
 
-	if conv.outputMarkdown {
-		fmt.Printf("![](%s)\n", conv.endImage)
-	} else {
-		fmt.Println(conv.endImage)
+	// A batch converts the inputs once, or on every run of -schedule
+	batch := func() int {
+		var jobs []*converter
+		var assets *assetsDir
+		var feed *feedSource
+		switch {
+		case command == "mirror":
+			jobs, err = loadMirror(flag.Args(), &conv)
+		case command == "migrate":
+			jobs, err = loadMigration(&conv)
+		case manifestPath != "":
+			jobs, err = loadManifest(manifestPath, &conv)
+		case assetsPath != "":
+			jobs, assets, err = loadAssets(assetsPath, &conv)
+		case feedURL != "":
+			jobs, feed, err = loadFeed(feedURL, &conv)
+		case len(recovered) > 0 && strings.TrimSpace(conv.startImage) == "" && conv.device == "":
+			// Only the recovered jobs run
+		case strings.TrimSpace(conv.startImage) == "" && conv.device == "" && !isTerminal(os.Stdin):
+			// Read sources from a pipe, e.g. cat urls.txt | go-gif-pr
+			jobs, err = readInputList(os.Stdin, &conv)
+		default:
+			err = conv.validate()
+			jobs = []*converter{&conv}
+		}
+		if err != nil {
+			printError(err)
+			return 1
+		}
+		if assets != nil && len(jobs) == 0 {
+			stage("assets", tr("up to date"))
+		}
+		if feed != nil && len(jobs) == 0 {
+			stage("feed", tr("no new entries"))
+		}
+		jobs = append(recovered, jobs...)
+		recovered = nil
+
+		for i, c := range jobs {
+			c.index = i
+			defer c.cleanup()
+		}
+		processJobs(jobs)
+
+		err = writePending(pendingPath, jobs)
+		if err != nil {
+			printError(err)
+		}
+		if conv.showTimings {
+			printTimings(jobs)
+		}
+		if assets != nil {
+			err = assets.save(jobs)
+			if err != nil {
+				printError(err)
+				return 1
+			}
+		}
+		if feed != nil {
+			err = feed.save(jobs)
+			if err != nil {
+				printError(err)
+				return 1
+			}
+		}
+
+		status := 0
+		for _, c := range jobs {
+			if c.err != nil {
+				status = 1
+			}
+		}
+
+		var results []*converter
+		for _, c := range jobs {
+			results = append(results, c.outputs()...)
+		}
+
+		if reportPath != "" {
+			err = writeReport(reportPath, results)
+			if err != nil {
+				printError(err)
+				return 1
+			}
+		}
+
+		var converted []*converter
+		for _, c := range results {
+			if c.err == nil {
+				converted = append(converted, c)
+			}
+		}
+		if !conv.noHistory && len(converted) > 0 {
+			err = recordHistory(converted)
+			if err != nil {
+				printError(errors.New("Could not record the history: " + err.Error()))
+			}
+		}
+		if len(converted) == 0 {
+			return status
+		}
+
+		// Jobs of a manifest may upload elsewhere, only imgur uploads have
+		// an album. Every -widths variant is uploaded, and added, on its own.
+		var uploaded []*converter
+		for _, c := range converted {
+			if c.uploaded() && c.uploader == "imgur" && c.imgurImage != nil {
+				uploaded = append(uploaded, c)
+			}
+		}
+		if conv.uploader == "imgur" && conv.privacy != "" && len(uploaded) > 0 {
+			album, err := conv.createAlbum(uploaded)
+			if err != nil {
+				printError(err)
+				return 1
+			}
+			progressLine.println(os.Stdout, album)
+		}
+
+		if siteDataPath != "" {
+			err = writeSiteData(siteDataPath, converted)
+			if err != nil {
+				printError(err)
+				return 1
+			}
+		}
+
+		if archivePath != "" {
+			err = writeArchive(archivePath, converted)
+			if err != nil {
+				printError(err)
+				return 1
+			}
+		}
+
+		if galleryDir != "" {
+			err = writeGallery(galleryDir, converted)
+			if err != nil {
+				printError(err)
+				return 1
+			}
+		}
+
+		return status
+	}
+
+	if schedule != nil {
+		return runScheduled(schedule, scheduleJitter, batch)
 	}
+	return batch()
+}
+
+func flagEnvName(name string) string {
+	if env, ok := flagEnvNames[name]; ok {
+		return env
+	}
+
+	return "GIFV_" + strings.ToUpper(strings.Replace(name, "-", "_", -1))
+}
+
+func applyFlagEnv(fs *flag.FlagSet) error {
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		env := flagEnvName(f.Name)
+		value, ok := os.LookupEnv(env)
+		if !ok || err != nil {
+			return
+		}
+
+		// Set through the flag set, so the flag counts as given
+		if setErr := fs.Set(f.Name, value); setErr != nil {
+			err = fmt.Errorf("Invalid value %q for %s: %v", value, env, setErr)
+		}
+	})
+
+	return err
 }
 
 func (c *converter) validate() error {
+	if c.device != "" {
+		if c.startImage != "" && c.startImage != c.device {
+			return errors.New("-device cannot be combined with another input")
+		}
+		if c.captureLength <= 0 {
+			return errors.New("-capture-duration must be positive")
+		}
+		c.startImage = c.device
+	}
+
 	if strings.TrimSpace(c.startImage) == "" {
-		return errors.New("You must provide an input URL or path")
+		return errors.New(tr("You must provide an input URL or path"))
+	}
+	// A timestamped link trims unless the job says otherwise
+	if c.trim == "" && c.frameRange == "" {
+		c.trim = linkTrim(c.startImage)
+		if c.trim != "" {
+			stage("trim", fmt.Sprintf(tr("%s from the link"), c.trim))
+		}
 	}
 
-	return nil
-}
+	if c.widthList != "" {
+		c.widths = nil
+		for _, width := range strings.Split(c.widthList, ",") {
+			width = strings.TrimSpace(width)
+			if _, err := strconv.Atoi(width); err != nil {
+				return errors.New("Invalid width in -widths: " + width)
+			}
+			c.widths = append(c.widths, width)
+		}
+		c.imageWidth = c.widths[0]
+	}
 
-func (c *converter) cleanup() {
-	if c.keepFiles {
-		return
+	err := c.applyPreset()
+	if err != nil {
+		return err
 	}
 
-	// Gather files to remove
-	var filesToRemove []string
+	switch c.format {
+	case "gif", "mp4", "webm":
+	default:
+		return errors.New("Format must be gif, mp4 or webm")
+	}
+	if c.trim != "" {
+		if _, _, err := parseTrim(c.trim); err != nil {
+			return err
+		}
+	}
+
+	if err := c.validateStill(); err != nil {
+		return err
+	}
+	if err := c.validateAudiogram(); err != nil {
+		return err
+	}
+	if err := c.validatePreview(); err != nil {
+		return err
+	}
+
+	if c.frameRange != "" {
+		if c.trim != "" {
+			return errors.New("-frames and -trim cannot be used together")
+		}
+		if _, _, err := parseFrames(c.frameRange); err != nil {
+			return err
+		}
+	}
 
-	// Remove downloaded file
-	if c.startImage != c.fileToConvert {
-		filesToRemove = append(filesToRemove, c.fileToConvert)
+	if c.holdFirst < 0 || c.holdLast < 0 {
+		return errors.New("-hold-first and -hold-last cannot be negative")
+	}
+	if err := c.validateAspect(); err != nil {
+		return err
+	}
+	if err := c.validateCards(); err != nil {
+		return err
+	}
+	if c.loopCrossfade < 0 {
+		return errors.New("-loop-crossfade cannot be negative")
+	}
+	// Only the frames are blended, the audio would no longer line up
+	if c.loopCrossfade > 0 && c.keepAudio {
+		return errors.New("-loop-crossfade cannot be used with -keep-audio")
 	}
 
-	// If file was not uploaded to imgur, leave local copy
-	if strings.TrimSpace(c.clientID) != "" {
-		filesToRemove = append(filesToRemove, c.outputImage)
+	if c.keepAudio && c.mute {
+		return errors.New("-keep-audio and -mute cannot be used together")
+	}
+	if c.speed <= 0 {
+		return errors.New("-speed must be positive")
+	}
+	if c.interpolate < 0 {
+		return errors.New("-interpolate cannot be negative")
+	}
+	// The atempo filter used to retime kept audio is limited to this range
+	if c.keepAudio && (c.speed < 0.5 || c.speed > 100) {
+		return errors.New("-speed must be between 0.5 and 100 with -keep-audio")
 	}
 
-	for _, f := range filesToRemove {
-		err := os.Remove(f)
+	switch c.uploader {
+	case "imgur":
+	case "github":
+		if c.githubRepo == "" {
+			return errors.New("The github uploader requires -github-repo")
+		}
+	case "jira", "confluence":
+		if c.atlassianURL == "" || c.atlassianUser == "" {
+			return errors.New("The " + c.uploader + " uploader requires -atlassian-url and -atlassian-user")
+		}
+		if c.uploader == "jira" && c.jiraIssue == "" {
+			return errors.New("The jira uploader requires -jira-issue")
+		}
+		if c.uploader == "confluence" && c.confluencePage == "" {
+			return errors.New("The confluence uploader requires -confluence-page")
+		}
+	default:
+		if _, err := uploaderPlugin(c.uploader); err != nil {
+			return errors.New("Unknown uploader: " + c.uploader + " (no " + uploaderPluginPrefix + c.uploader + " plugin on PATH)")
+		}
+	}
+
+	if c.nameTemplate != "" {
+		tmpl, err := template.New("name").Parse(c.nameTemplate)
 		if err != nil {
-			fmt.Println("Could not remove file: ", c.fileToConvert)
+			return errors.New("Invalid name template: " + err.Error())
 		}
+		c.nameTmpl = tmpl
 	}
-}
 
-func (c *converter) fetchFile() error {
-	// Download the file if remote
-	if strings.HasPrefix(c.startImage, "http") {
-		err := c.fetchRemote()
+	if err := c.validateLimit(); err != nil {
+		return err
+	}
+	switch c.optimizer {
+	case "auto", "gifsicle", "builtin":
+	default:
+		return errors.New("-optimizer must be auto, gifsicle or builtin")
+	}
+	if err := c.createWorkDir(); err != nil {
+		return err
+	}
+	if err := c.validateQuantizer(); err != nil {
+		return err
+	}
+	if c.optimizeJobs < 1 {
+		return errors.New("-optimize-jobs must be at least 1")
+	}
+	if c.threadCount < 0 {
+		return errors.New("-threads cannot be negative")
+	}
+	if err := c.validateFallback(); err != nil {
 		return err
 	}
+	if c.frameDelay != "" {
+		if c.format != "gif" {
+			return errors.New("-frame-delay only applies to gif outputs")
+		}
+		if _, err := parseDelays(c.frameDelay); err != nil {
+			return err
+		}
+	}
 
-	c.fileToConvert = c.startImage
+	switch c.shortcodeStyle {
+	case "", "hugo", "jekyll":
+	default:
+		return errors.New("Shortcode must be hugo or jekyll")
+	}
 
-	// Check if the file exists
-	if _, err := os.Stat(c.fileToConvert); os.IsNotExist(err) {
-		return errors.New("Input file does not exist")
+	switch c.privacy {
+	case "", "public", "hidden", "secret":
+	default:
+		return errors.New("Privacy must be public, hidden or secret")
 	}
 
 	return nil
 }
 
-func (c *converter) fetchRemote() error {
-	url, err := url.Parse(c.startImage)
+// processJobs converts each job in turn while a second stage uploads the
+// finished outputs, so upload latency overlaps with the next conversion.
+func processJobs(jobs []*converter) {
+	// Jobs are converted one at a time while earlier ones are optimized
+	optimizeJobs := 1
+	if len(jobs) > 0 {
+		optimizeJobs = jobs[0].optimizeJobs
+		optimizeSlots = make(chan struct{}, optimizeJobs)
+		ffmpegThreads = jobs[0].threads()
+	}
+	uploads := make(chan *converter, optimizeJobs)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		for c := range uploads {
+			// Results are printed in the order of the jobs
+			<-c.finished
+			if c.err != nil {
+				c.printResult()
+				continue
+			}
+
+			start := time.Now()
+			act := beginStage("upload")
+			for _, o := range c.outputs() {
+				o.err = o.upload()
+				if o.err == nil && o.uploaded() {
+					o.rewriteLinks()
+					stage("upload", o.endImage)
+					o.err = o.runHook("post-upload", o.postUploadCmd, o.outputImage, o.endImage)
+				}
+				if o.err != nil && c.err == nil {
+					c.err = o.err
+				}
+			}
+			act.end()
+			c.duration += time.Since(start)
+			c.timings.Upload += time.Since(start)
+			for _, v := range c.variants {
+				v.duration = c.duration
+				v.timings = c.timings
+			}
+			c.printResult()
+		}
+	}()
+
+	if len(jobs) > 0 && jobs[0].sharedPalette {
+		sharePalette(jobs)
+		if !jobs[0].keepFiles {
+			defer os.Remove(jobs[0].workPath(paletteFileName))
+		}
+	}
+
+	// Failed jobs go through the uploads too, finished already, so that
+	// their results are printed in order
+	failed := make(chan struct{})
+	close(failed)
+
+	for _, c := range jobs {
+		if c.err != nil {
+			// Failed while fetching the sources for the shared palette
+			c.finished = failed
+			uploads <- c
+			continue
+		}
+		if shuttingDown() {
+			c.err = errNotStarted
+			continue
+		}
+
+		start := time.Now()
+		c.err = c.prepare()
+		c.duration += time.Since(start)
+		if c.err != nil {
+			c.finished = failed
+			uploads <- c
+			continue
+		}
+		if c.dryRun {
+			c.printPlan()
+			continue
+		}
+
+		c.finished = make(chan struct{})
+		go func(c *converter) {
+			defer close(c.finished)
+			start := time.Now()
+			c.err = c.finish()
+			c.duration += time.Since(start)
+		}(c)
+		uploads <- c
+	}
+
+	close(uploads)
+	<-done
+}
+
+// prepare fetches and converts a single input, ready for upload
+func (c *converter) prepare() error {
+	// Sources are fetched ahead of time for a shared palette
+	if c.meta == nil {
+		err := c.fetchSource()
+		if err != nil {
+			return err
+		}
+	}
+	if c.dryRun {
+		return nil
+	}
+	if c.unchanged {
+		return c.copyUnchanged()
+	}
+	if c.previewFirst {
+		err := c.confirmPreview()
+		if err != nil {
+			return err
+		}
+	}
+
+	err := c.checkCrossfade()
+	if err != nil {
+		return err
+	}
+	err = c.checkProgressOverlay()
 	if err != nil {
 		return err
 	}
 
-	fileExt := path.Ext(url.Path)
-	// Gifv is a container for mp4
-	if fileExt == ".gifv" {
-		fileExt = ".mp4"
-		c.startImage = strings.Replace(c.startImage, ".gifv", ".mp4", -1)
+	return c.convert()
+}
+
+// finish optimizes the outputs of a converted job and runs the post-convert
+// hooks. Jobs are finished concurrently, bounded by -optimize-jobs.
+func (c *converter) finish() error {
+	// Outputs that could be retuned were optimized while converting, and
+	// mirrors and migrated outputs are uploaded exactly as fetched
+	if !c.unchanged && (len(c.variants) > 0 || !c.retunable()) {
+		stop := timed(&c.timings.Optimize)
+		err := optimizeOutputs(c.outputs())
+		stop()
+		if err != nil {
+			return err
+		}
 	}
-	c.fileToConvert = tempFileName + fileExt
-	temp, err := os.Create(c.fileToConvert)
-	defer temp.Close()
 
-	client := &http.Client{
-		Timeout: 10 * time.Second,
+	err := commitOutputs(c.outputs())
+	if err != nil {
+		return err
 	}
+	for _, o := range c.outputs() {
+		stage("convert", o.outputImage)
+		err := o.runHook("post-convert", o.postConvertCmd, o.outputImage, "")
+		if err != nil {
+			return err
+		}
+		// Measured after the hook, which may have optimized the file further
+		o.outputSize = fileSize(o.outputImage)
+	}
+
+	return c.suggestAlt()
+}
 
-	req, err := http.NewRequest("GET", c.startImage, nil)
+// fetchSource downloads and analyzes the input
+func (c *converter) fetchSource() error {
+	defer timed(&c.timings.Fetch)()
 
-	resp, err := client.Do(req)
+	err := c.fetchFile()
 	if err != nil {
 		return err
 	}
-	defer resp.Body.Close()
+	err = c.saveWorkspace(false)
+	if err != nil {
+		return err
+	}
+	c.sourceSize = fileSize(c.fileToConvert)
+	stage("fetch", c.startImage)
 
-	_, err = io.Copy(temp, resp.Body)
+	err = c.runHook("pre-convert", c.preConvertCmd, c.fileToConvert, "")
 	if err != nil {
 		return err
 	}
 
+	c.meta, err = probe(shutdownCtx, c.fileToConvert)
+	if err != nil {
+		return err
+	}
+	err = c.checkDecoder()
+	if err != nil {
+		return err
+	}
+	if c.meta.AudioOnly {
+		err = c.renderAudiogram()
+		if err != nil {
+			return err
+		}
+	}
+	if c.stabilize && !c.meta.Still && !c.dryRun {
+		err = c.detectShake()
+		if err != nil {
+			return err
+		}
+	}
+	if c.autoCrop {
+		c.crop, err = c.detectMotion()
+		if err != nil {
+			return err
+		}
+		stage("analyze", fmt.Sprintf(tr("motion in %s"), c.crop.String()))
+	}
+
 	return nil
 }
 
-func (c *converter) convert() error {
-	// Convert movie to gif
-	c.outputImage = outputFileName + ".gif"
-	ffmpeg := exec.Command("ffmpeg", "-i", c.fileToConvert, "-pix_fmt", "rgb24", "-vf", "scale="+c.imageWidth+":-1", "-f", "gif", c.outputImage)
+func (c *converter) printResult() {
+	if c.outputJSON {
+		if c.err != nil && len(c.variants) == 0 {
+			printError(c.err)
+		}
+		for _, o := range c.outputs() {
+			line, _ := json.Marshal(o.reportEntry())
+			progressLine.println(os.Stdout, string(line))
+		}
+		return
+	}
 
-	var ffmpegErr bytes.Buffer
-	ffmpeg.Stderr = &ffmpegErr
+	if c.err != nil {
+		printError(c.err)
+		return
+	}
+
+	if len(c.variants) > 0 {
+		progressLine.println(os.Stdout, c.srcset())
+		return
+	}
+
+	if c.uploaded() && (c.uploader == "jira" || c.uploader == "confluence") {
+		progressLine.println(os.Stdout, c.wikiMarkup())
+	} else if c.shortcodeStyle != "" {
+		progressLine.println(os.Stdout, c.shortcode())
+	} else if c.outputMarkdown {
+		progressLine.println(os.Stdout, "!["+c.markdownAlt()+"]("+colorize(stdoutColor, colorCyan, c.endImage)+")")
+	} else {
+		progressLine.println(os.Stdout, colorize(stdoutColor, colorCyan, c.endImage))
+	}
+	if c.imgurPage != "" {
+		progressLine.println(os.Stdout, colorize(stdoutColor, colorCyan, c.imgurPage))
+	}
+}
 
-	err := ffmpeg.Run()
+// printPlan prints what a dry run found out about the input
+func (c *converter) printPlan() {
+	plan := "no changes"
+	if c.crop != nil {
+		plan = c.crop.filter()
+	}
+
+	progressLine.println(os.Stdout, c.startImage+" "+plan)
+}
+
+// suffix distinguishes the default file names of jobs after the first
+func (c *converter) suffix() string {
+	if c.index == 0 {
+		return ""
+	}
+
+	return "-" + strconv.Itoa(c.index+1)
+}
+
+func fileSize(name string) int64 {
+	info, err := os.Stat(name)
 	if err != nil {
-		return errors.New(fmt.Sprint(err) + ": " + ffmpegErr.String())
+		return 0
 	}
 
-	// Optimize gif
-	sickle := exec.Command("gifsicle", "--careful", "-O3", "--batch", c.outputImage)
+	return info.Size()
+}
 
-	var sicklekErr bytes.Buffer
-	sickle.Stderr = &sicklekErr
+func (c *converter) cleanup() {
+	if c.keepFiles {
+		// Not to be taken for the workspace of a crashed run
+		c.saveWorkspace(true)
+		return
+	}
+	// The download and intermediary files go with the workspace
+	defer c.removeWorkspace()
+
+	// Gather files to remove
+	var filesToRemove []string
+
+	// If file was not uploaded, leave local copy. Outputs of failed jobs are
+	// kept for debugging.
+	if c.uploadEnabled() && c.err == nil {
+		for _, o := range c.outputs() {
+			filesToRemove = append(filesToRemove, o.outputImage)
+		}
+	} else if c.err != nil {
+		for _, o := range c.outputs() {
+			if fileSize(o.outputImage) > 0 {
+				progressLine.println(os.Stderr, fmt.Sprintf(tr("Kept %s of the failed job"), o.outputImage))
+			}
+		}
+	}
 
-	err = sickle.Run()
+	for _, f := range filesToRemove {
+		if f == "" {
+			continue
+		}
+		err := retryBusy(func() error { return os.Remove(f) })
+		if err != nil {
+			fmt.Fprintln(os.Stderr, fmt.Sprintf(tr("Could not remove file: %s"), f))
+		}
+	}
+}
+
+func (c *converter) fetchFile() error {
+	if c.resumed != "" {
+		c.fileToConvert = c.resumed
+		return nil
+	}
+	if c.device != "" {
+		err := c.openWorkspace()
+		if err != nil {
+			return err
+		}
+		return c.captureDevice()
+	}
+
+	src, err := normalizeSource(c.startImage)
 	if err != nil {
-		return errors.New(fmt.Sprint(err) + ": " + sicklekErr.String())
+		return err
+	}
+	c.startImage = src
+
+	// Download the file if remote, into a workspace a crashed run can resume
+	if isRemote(c.startImage) {
+		err := c.openWorkspace()
+		if err != nil {
+			return err
+		}
+		return c.fetchRemote()
+	}
+
+	c.fileToConvert = c.startImage
+
+	// Check if the file exists
+	if _, err := os.Stat(c.fileToConvert); os.IsNotExist(err) {
+		return errors.New(tr("Input file does not exist"))
 	}
 
 	return nil
 }
 
-func (c *converter) upload() error {
-	clientID := strings.TrimSpace(c.clientID)
-	if clientID == "" {
-		fmt.Println("No imgur Client ID provided. File will be retained locally.")
-		c.endImage = c.outputImage
-		return nil
+func (c *converter) fetchRemote() error {
+	src, err := c.resolveSource(c.startImage)
+	if err != nil {
+		return err
 	}
 
-	// Prepare multi-part body
-	var b bytes.Buffer
-	w := multipart.NewWriter(&b)
-	f, err := os.Open(c.outputImage)
+	url, err := url.Parse(src)
 	if err != nil {
 		return err
 	}
-	defer f.Close()
-	fw, err := w.CreateFormFile("image", c.outputImage)
+	err = c.checkHost(url.Hostname())
 	if err != nil {
 		return err
 	}
-	if _, err = io.Copy(fw, f); err != nil {
+
+	fileExt := sanitizeExt(path.Ext(url.Path))
+	// Gifv is a container for mp4
+	if fileExt == ".gifv" {
+		fileExt = ".mp4"
+		src = strings.Replace(src, ".gifv", ".mp4", -1)
+	}
+	c.fileToConvert = c.tempPath(tempFileName + c.suffix() + fileExt)
+	req, err := http.NewRequestWithContext(shutdownCtx, "GET", src, nil)
+	if err != nil {
 		return err
 	}
-	w.Close()
+	cached := c.revalidate(req)
 
-	req, err := http.NewRequest("POST", imgurAPIEndpoint, &b)
+	resp, err := c.fetchClient().Do(req)
 	if err != nil {
 		return err
 	}
-	req.Header.Set("Content-Type", w.FormDataContentType())
-	req.Header.Set("Authorization", "Client-ID "+c.clientID)
+	defer resp.Body.Close()
 
-	client := &http.Client{
-		Timeout: 10 * time.Second,
+	// An error page must not become the source, or the cached download
+	notModified := cached != nil && resp.StatusCode == http.StatusNotModified
+	if resp.StatusCode != http.StatusOK && !notModified {
+		return fmt.Errorf(tr("Download failed: %s returned %s"), src, resp.Status)
 	}
 
-	resp, err := client.Do(req)
+	temp, err := os.Create(c.fileToConvert)
 	if err != nil {
 		return err
 	}
-	defer resp.Body.Close()
+	defer temp.Close()
+
+	if notModified {
+		stage("fetch", tr("not modified, using the cached download"))
+		return cached.copyTo(temp)
+	}
+
+	act := beginStage("fetch")
+	defer act.end()
 
-	var imgur imgurResponse
-	err = json.NewDecoder(resp.Body).Decode(&imgur)
+	body := &progressReader{r: resp.Body, act: act, total: resp.ContentLength}
+	_, err = io.Copy(temp, c.throttle(body))
+	if err != nil {
+		return err
+	}
+	err = temp.Close()
 	if err != nil {
 		return err
 	}
 
-	if imgur.Success {
-		c.endImage = imgur.Data.Link
-	} else {
-		return errors.New("imgur error: " + imgur.Data.Err)
+	if !c.noCache {
+		err = cacheDownload(src, resp, c.fileToConvert)
+		if err != nil {
+			printError(errors.New("Could not cache the download: " + err.Error()))
+		}
 	}
 
 	return nil
 }
+
+func sameFile(a, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+
+	return errA == nil && errB == nil && absA == absB
+}
+
+// uploadEnabled reports whether the output is meant to be uploaded at all
+func (c *converter) uploadEnabled() bool {
+	if c.noUpload {
+		return false
+	}
+
+	return c.uploader != "imgur" || strings.TrimSpace(c.clientID) != ""
+}
+
+func (c *converter) upload() error {
+	if c.noUpload || c.uploadEnabled() && !c.checkUploadLimit() {
+		c.endImage = c.outputImage
+		return nil
+	}
+
+	switch c.uploader {
+	case "github":
+		return c.uploadGitHub()
+	case "jira":
+		return c.uploadJira()
+	case "confluence":
+		return c.uploadConfluence()
+	case "imgur":
+		return c.uploadImgur()
+	}
+
+	return c.uploadPlugin()
+}
+
+// uploaded reports whether the output was uploaded rather than left locally
+func (c *converter) uploaded() bool {
+	return c.endImage != "" && c.endImage != c.outputImage
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// loadManifest reads a YAML batch manifest and returns one job per entry,
+// each starting from the global options in defaults. Only the YAML needed
+// for a list of flat mappings is supported:
+//
+//	jobs:
+//	  - source: https://i.imgur.com/example.gifv
+//	    width: 480
+//	    trim: 2-6.5
+//	    caption: "Login flow"
+//	    alt: "Signing in with a passkey"
+//	    uploader: github
+//	    tags: onboarding, login
+//
+// The top level jobs key is optional.
+func loadManifest(manifestPath string, defaults *converter) ([]*converter, error) {
+	f, err := os.Open(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	entries, err := parseManifest(f)
+	if err != nil {
+		return nil, errors.New(manifestPath + ": " + err.Error())
+	}
+
+	var jobs []*converter
+	for i, entry := range entries {
+		job := *defaults
+		for key, value := range entry {
+			switch key {
+			case "source":
+				job.startImage = value
+			case "width":
+				job.imageWidth = value
+				job.widthList = ""
+				job.widthSet = true
+			case "trim":
+				job.trim = value
+			case "caption":
+				job.caption = value
+			case "alt":
+				job.alt = value
+			case "uploader":
+				job.uploader = value
+			case "tags":
+				// Added to the tags of the command line
+				job.tags = append(tagList(nil), job.tags...)
+				err = job.tags.Set(value)
+				if err != nil {
+					return nil, fmt.Errorf("%s: entry %d: %v", manifestPath, i+1, err)
+				}
+			default:
+				return nil, fmt.Errorf("%s: entry %d: unknown key %q", manifestPath, i+1, key)
+			}
+		}
+
+		err = job.validate()
+		if err != nil {
+			return nil, fmt.Errorf("%s: entry %d: %v", manifestPath, i+1, err)
+		}
+		jobs = append(jobs, &job)
+	}
+
+	return jobs, nil
+}
+
+// readInputList returns one job per non-empty line of r. Lines starting
+// with # are ignored.
+func readInputList(r io.Reader, defaults *converter) ([]*converter, error) {
+	var jobs []*converter
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		source := strings.TrimSpace(scanner.Text())
+		if source == "" || strings.HasPrefix(source, "#") {
+			continue
+		}
+
+		job := *defaults
+		job.startImage = source
+		err := job.validate()
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, &job)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(jobs) == 0 {
+		return nil, errors.New("You must provide an input URL or path")
+	}
+
+	return jobs, nil
+}
+
+func parseManifest(r io.Reader) ([]map[string]string, error) {
+	var entries []map[string]string
+	var current map[string]string
+
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := stripComment(scanner.Text())
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || trimmed == "---" || trimmed == "jobs:" {
+			continue
+		}
+
+		if strings.HasPrefix(trimmed, "- ") || trimmed == "-" {
+			current = map[string]string{}
+			entries = append(entries, current)
+			trimmed = strings.TrimSpace(strings.TrimPrefix(trimmed, "-"))
+			if trimmed == "" {
+				continue
+			}
+		}
+		if current == nil {
+			return nil, fmt.Errorf("line %d: expected a list entry starting with -", n)
+		}
+
+		i := strings.Index(trimmed, ":")
+		if i == -1 {
+			return nil, fmt.Errorf("line %d: expected key: value", n)
+		}
+		key := strings.TrimSpace(trimmed[:i])
+		value, err := unquote(strings.TrimSpace(trimmed[i+1:]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", n, err)
+		}
+		current[key] = value
+	}
+
+	return entries, scanner.Err()
+}
+
+// stripComment removes a trailing # comment that is not inside quotes
+func stripComment(line string) string {
+	var quote rune
+	for i, c := range line {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+
+	return line
+}
+
+func unquote(value string) (string, error) {
+	if len(value) >= 2 {
+		switch {
+		case value[0] == '"' && value[len(value)-1] == '"':
+			return strconv.Unquote(value)
+		case value[0] == '\'' && value[len(value)-1] == '\'':
+			return strings.Replace(value[1:len(value)-1], "''", "'", -1), nil
+		}
+	}
+
+	return value, nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// loadMigration returns a job for every output in the history that is not
+// yet on the uploader of defaults, which migrate sets from -to. Outputs
+// still on disk are uploaded as they are, the others are fetched and
+// converted again from their source with the options of the command line.
+// With -tag only the entries carrying every given tag are migrated.
+func loadMigration(defaults *converter) ([]*converter, error) {
+	path, err := historyPath()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := readHistory(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// The latest entry of an output tells where it is now
+	latest := make(map[string]historyEntry)
+	var order []string
+	for _, entry := range entries {
+		if entry.Status != "ok" {
+			continue
+		}
+		key := entry.Output
+		if key == "" {
+			key = entry.Source
+		}
+		if _, ok := latest[key]; !ok {
+			order = append(order, key)
+		}
+		latest[key] = entry
+	}
+
+	var jobs []*converter
+entries:
+	for _, key := range order {
+		entry := latest[key]
+		if entry.Uploader == defaults.uploader {
+			continue
+		}
+		for _, tag := range defaults.tags {
+			if !tagList(entry.Tags).has(tag) {
+				continue entries
+			}
+		}
+
+		job := *defaults
+		job.tags = entry.Tags
+		job.migration = &entry
+		job.format = entry.Format
+		if fileSize(entry.Output) > 0 {
+			job.startImage = entry.Output
+			job.unchanged = true
+			job.keepName = true
+		} else {
+			job.startImage = entry.Source
+		}
+		err = job.validate()
+		if err != nil {
+			return nil, errors.New(entry.Source + ": " + err.Error())
+		}
+		jobs = append(jobs, &job)
+	}
+
+	if len(jobs) == 0 {
+		stage("migrate", fmt.Sprintf(tr("every output is already on %s"), defaults.uploader))
+	}
+
+	return jobs, nil
+}
+
+// migratedEntry returns the history entry of a migrated output. It keeps
+// the source and output of the entry it replaces, so the next migration
+// finds the output on its new host.
+func (c *converter) migratedEntry(entry historyEntry) historyEntry {
+	entry.Source = c.migration.Source
+	entry.Output = c.migration.Output
+	entry.MigratedFrom = c.migration.URL
+
+	return entry
+}
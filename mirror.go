@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// loadMirror returns one job per imgur link, each downloading the existing
+// video or GIF and uploading it unchanged to the configured uploader:
+//
+//	go-gif-pr mirror -uploader github https://i.imgur.com/abc.gifv https://imgur.com/def
+func loadMirror(links []string, defaults *converter) ([]*converter, error) {
+	if len(links) == 0 {
+		return nil, errors.New("mirror needs the imgur links to copy, e.g. go-gif-pr mirror -uploader github https://i.imgur.com/abc.gifv")
+	}
+	if defaults.uploader == "imgur" {
+		return nil, errors.New("mirror copies imgur links to another host, choose it with -uploader")
+	}
+
+	var jobs []*converter
+	for _, link := range links {
+		src, format, err := imgurMedia(link)
+		if err != nil {
+			return nil, err
+		}
+
+		job := *defaults
+		job.startImage = src
+		job.format = format
+		job.unchanged = true
+		job.mirror = true
+		// Named after the imgur ID, which is also the title without one
+		job.keepName = true
+		err = job.validate()
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, &job)
+	}
+
+	return jobs, nil
+}
+
+// imgurMedia returns the direct link and format of the animation behind an
+// imgur link, which may be a .gifv, .mp4 or .gif file or an image page
+func imgurMedia(link string) (string, string, error) {
+	src, err := normalizeSource(link)
+	if err != nil {
+		return "", "", err
+	}
+	u, err := url.Parse(src)
+	if err != nil || !isRemote(src) {
+		return "", "", errors.New("Not an imgur link: " + link)
+	}
+	host := strings.ToLower(u.Hostname())
+	if host != "imgur.com" && !strings.HasSuffix(host, ".imgur.com") {
+		return "", "", errors.New("Not an imgur link: " + link)
+	}
+
+	p := strings.Trim(u.Path, "/")
+	if p == "" || strings.Contains(p, "/") {
+		return "", "", errors.New("Albums and galleries cannot be mirrored, link each image instead: " + link)
+	}
+	ext := strings.ToLower(path.Ext(p))
+	id := strings.TrimSuffix(p, path.Ext(p))
+
+	switch ext {
+	case "", ".gifv", ".mp4":
+		// Imgur serves every animation as mp4
+		return "https://i.imgur.com/" + id + ".mp4", "mp4", nil
+	case ".gif":
+		return "https://i.imgur.com/" + id + ".gif", "gif", nil
+	}
+
+	return "", "", errors.New("Not an imgur video or GIF: " + link)
+}
+
+// copyUnchanged writes the source to the output as it is. Mirrors also
+// look up the title of the imgur image, which ffmpeg never sees.
+func (c *converter) copyUnchanged() error {
+	defer timed(&c.timings.Convert)()
+
+	name, err := c.outputName()
+	if err != nil {
+		return err
+	}
+	c.outputImage = partialPath(c.workPath(name) + "." + c.format)
+	if !isRemote(c.startImage) {
+		// Local files stay where they are, uploads remove their copy in
+		// the workspace
+		err = c.openWorkspace()
+		if err != nil {
+			return err
+		}
+		c.outputImage = partialPath(c.tempPath(name + "." + c.format))
+	}
+	err = copyFile(c.fileToConvert, c.outputImage)
+	if err != nil {
+		return err
+	}
+	if !c.mirror {
+		return nil
+	}
+
+	clientID, ok := c.clientIDs.get()
+	if !ok {
+		c.warn(warnMirrorTitle, errors.New(tr("Set an imgur Client ID to copy the titles of mirrored images")))
+		return nil
+	}
+	err = c.waitLookup(imgurAPIEndpoint)
+	if err != nil {
+		return err
+	}
+	c.mirrorTitle, err = fetchImgurTitle(&http.Client{Timeout: c.timeout}, clientID, c.sourceName())
+	if err != nil {
+		c.warn(warnMirrorTitle, fmt.Errorf(tr("Could not look up the imgur title: %v"), err))
+	}
+
+	return nil
+}
+
+func fetchImgurTitle(client *http.Client, clientID, id string) (string, error) {
+	req, err := http.NewRequestWithContext(shutdownCtx, "GET", imgurAPIEndpoint+"/"+id, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Client-ID "+clientID)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var image struct {
+		Data struct {
+			Title string
+		}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("imgur returned %s", resp.Status)
+	}
+	err = json.NewDecoder(resp.Body).Decode(&image)
+	if err != nil {
+		return "", err
+	}
+
+	return image.Data.Title, nil
+}
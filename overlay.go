@@ -0,0 +1,31 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+)
+
+// Height in pixels of the progress bar, at the output size
+const progressBarHeight = 4
+
+// checkProgressOverlay makes sure the output duration is known, which the
+// progress bar grows towards
+func (c *converter) checkProgressOverlay() error {
+	if c.progressBar && c.expectedDuration() == 0 {
+		return errors.New("-progress-overlay needs a source with a known duration")
+	}
+
+	return nil
+}
+
+// progressFilter draws a bar along the bottom of the frame that fills up
+// over the length of the output. The bar is wider than any output and slides
+// in from the left, so its size does not depend on the scaled width. Labels
+// are suffixed so several widths can share a filter graph.
+func (c *converter) progressFilter(suffix string) string {
+	duration := strconv.FormatFloat(c.expectedDuration().Seconds(), 'f', -1, 64)
+
+	return "null[pv" + suffix + "];" +
+		"color=c=" + c.progressColor + ":s=8192x" + strconv.Itoa(progressBarHeight) + "[pbar" + suffix + "];" +
+		"[pv" + suffix + "][pbar" + suffix + "]overlay=x='W*t/" + duration + "-w':y=H-h:shortest=1"
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Frames are sampled for the shared palette at this rate and size, which is
+// plenty to gather the colors of a clip
+const (
+	paletteSampleRate   = 2
+	paletteSampleWidth  = 320
+	paletteSampleHeight = 240
+)
+
+// sharePalette fetches every source up front and generates a single palette
+// from all of them, which each GIF output then maps its colors to. Jobs that
+// fail to fetch are skipped, and reported in order by processJobs.
+func sharePalette(jobs []*converter) {
+	var sources []*converter
+	for _, c := range jobs {
+		if shuttingDown() {
+			return
+		}
+
+		start := time.Now()
+		c.err = c.fetchSource()
+		c.duration = time.Since(start)
+		if c.err != nil {
+			continue
+		}
+		if c.format == "gif" && !c.dryRun {
+			sources = append(sources, c)
+		}
+	}
+	if len(sources) == 0 {
+		return
+	}
+
+	err := generatePalette(sources)
+	if err != nil {
+		err = errors.New("Could not generate the shared palette, converting with separate palettes: " + err.Error())
+		printError(err)
+		for _, c := range sources {
+			c.warnings = append(c.warnings, warning{Code: warnSharedPalette, Message: err.Error()})
+		}
+		return
+	}
+	stage("palette", fmt.Sprintf(tr("shared by %d inputs"), len(sources)))
+
+	for _, c := range sources {
+		c.palette = sources[0].workPath(paletteFileName)
+	}
+}
+
+// generatePalette samples frames of every source, padded to a common size,
+// and writes the palette that best covers all of them
+func generatePalette(sources []*converter) error {
+	var args []string
+	var graph, inputs string
+	var total time.Duration
+	for i, c := range sources {
+		args = append(args, c.inputArgs()...)
+		total += c.trimmedDuration()
+
+		filters := append(c.frameFilters(), c.rotationFilters()...)
+		if c.crop != nil {
+			filters = append(filters, c.crop.filter())
+		}
+		if c.meta.HDR && !c.noTonemap {
+			filters = append(filters, tonemapFilter)
+		}
+		filters = append(filters,
+			fmt.Sprintf("fps=%d", paletteSampleRate),
+			fmt.Sprintf("scale=%d:%d:force_original_aspect_ratio=decrease", paletteSampleWidth, paletteSampleHeight),
+			fmt.Sprintf("pad=%d:%d:(ow-iw)/2:(oh-ih)/2", paletteSampleWidth, paletteSampleHeight),
+			"setsar=1", "format=rgb24")
+		graph += fmt.Sprintf("[%d:v]%s[ps%d];", i, strings.Join(filters, ","), i)
+		inputs += fmt.Sprintf("[ps%d]", i)
+	}
+	graph += fmt.Sprintf("%sconcat=n=%d:v=1:a=0,palettegen=stats_mode=full[palette]", inputs, len(sources))
+
+	args = append(args, "-y", "-filter_complex", graph, "-map", "[palette]", sources[0].workPath(paletteFileName))
+	return runFFmpeg("palette", total, args)
+}
+
+// sharedPaletteFilter maps the colors of the output to the shared palette.
+// Labels are suffixed so several widths can share a filter graph.
+func (c *converter) sharedPaletteFilter(suffix string) string {
+	return "null[sv" + suffix + "];movie=" + filterPath(c.palette) + "[sp" + suffix + "];[sv" + suffix + "][sp" + suffix + "]paletteuse"
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"io"
+	"os"
+)
+
+// passThrough reports whether a GIF source can become the output as is,
+// because nothing asks for its frames to change. Re-encoding it would only
+// lose colors. An explicit -w or -widths counts as a change, the default
+// width does not.
+func (c *converter) passThrough() bool {
+	if c.forceReencode || c.format != "gif" || !c.gifSource() || c.meta.Still {
+		return false
+	}
+	if c.widthSet || c.retunable() || c.trim != "" || c.frameRange != "" || c.speed != 1 || c.interpolate > 0 {
+		return false
+	}
+	if c.holdFirst > 0 || c.holdLast > 0 || c.loopCrossfade > 0 || c.titleCard != "" || c.endCard != "" {
+		return false
+	}
+	if c.caption != "" || c.progressBar || len(c.blurRegions) > 0 || c.aspect != "" || c.crop != nil {
+		return false
+	}
+	// The shared palette is generated for every job of the batch, so it is
+	// checked by flag rather than by c.palette being set already. Frame
+	// delays are set by the optimizer, but the builtin one leaves source
+	// GIFs with changing transparency as they are, delays included.
+	if c.sharedPalette || c.palette != "" || c.frameDelay != "" {
+		return false
+	}
+	// -zoom and -pan only animate stills, which never pass through
+
+	return !c.stabilize && !c.textMode && c.quantizer == "" && len(c.meta.rotationFilters()) == 0
+}
+
+// copySource writes the source GIF to the output unchanged
+func (c *converter) copySource() error {
+	stage("convert", tr("source is already a GIF, skipping ffmpeg (use -force-reencode to convert it anyway)"))
+
+	src, err := os.Open(c.fileToConvert)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.Create(c.outputImage)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+	_, err = io.Copy(dst, src)
+	if err != nil {
+		return err
+	}
+
+	return dst.Close()
+}
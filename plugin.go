@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Plugins are executables on PATH with these prefixes. They read a single
+// JSON request on stdin and write a single JSON response to stdout.
+const (
+	uploaderPluginPrefix = "gifv-uploader-"
+	resolverPluginPrefix = "gifv-resolver-"
+)
+
+type uploaderPluginRequest struct {
+	File   string `json:"file"`
+	Source string `json:"source"`
+	Name   string `json:"name"`
+	Title  string `json:"title,omitempty"`
+	Format string `json:"format"`
+}
+
+type resolverPluginRequest struct {
+	URL string `json:"url"`
+}
+
+// pluginResponse is shared by both plugin kinds. A resolver leaves URL empty
+// for pages it does not handle.
+type pluginResponse struct {
+	URL   string `json:"url"`
+	Error string `json:"error"`
+}
+
+// uploaderPlugin returns the path of the plugin implementing an uploader
+func uploaderPlugin(name string) (string, error) {
+	return exec.LookPath(uploaderPluginPrefix + name)
+}
+
+func (c *converter) uploadPlugin() error {
+	plugin, err := uploaderPlugin(c.uploader)
+	if err != nil {
+		return err
+	}
+
+	file, err := filepath.Abs(c.outputImage)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(shutdownCtx, c.timeout)
+	defer cancel()
+
+	resp, err := callPlugin(ctx, plugin, uploaderPluginRequest{
+		File:   file,
+		Source: c.startImage,
+		Name:   filepath.Base(c.outputImage),
+		Title:  c.uploadTitle(),
+		Format: c.format,
+	})
+	if err != nil {
+		return err
+	}
+	if resp.URL == "" {
+		return errors.New(filepath.Base(plugin) + " returned no URL")
+	}
+
+	c.endImage = resp.URL
+	return nil
+}
+
+var resolverPlugins struct {
+	once  sync.Once
+	paths []string
+}
+
+// findResolverPlugins lists the resolver plugins on PATH, in name order
+func findResolverPlugins() []string {
+	resolverPlugins.once.Do(func() {
+		seen := make(map[string]bool)
+		for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				continue
+			}
+			for _, entry := range entries {
+				name := entry.Name()
+				if runtime.GOOS == "windows" {
+					name = strings.TrimSuffix(name, ".exe")
+				}
+				if !strings.HasPrefix(name, resolverPluginPrefix) || seen[name] {
+					continue
+				}
+				info, err := entry.Info()
+				if err != nil || info.IsDir() || (runtime.GOOS != "windows" && info.Mode()&0111 == 0) {
+					continue
+				}
+				// Earlier PATH entries win, as with any other command
+				seen[name] = true
+				resolverPlugins.paths = append(resolverPlugins.paths, filepath.Join(dir, entry.Name()))
+			}
+		}
+		sort.Slice(resolverPlugins.paths, func(i, j int) bool {
+			return filepath.Base(resolverPlugins.paths[i]) < filepath.Base(resolverPlugins.paths[j])
+		})
+	})
+
+	return resolverPlugins.paths
+}
+
+// resolved caches the answers of the resolver plugins for the run, so a
+// batch listing the same page twice only asks once
+var resolved = struct {
+	sync.Mutex
+	urls map[string]string
+}{urls: make(map[string]string)}
+
+// lookups remembers the time of the latest lookup claimed on each host
+var lookups = struct {
+	sync.Mutex
+	last map[string]time.Time
+}{last: make(map[string]time.Time)}
+
+// waitLookup spaces the lookups of each host by -resolve-interval: resolver
+// fetches, plugin calls for pages on the host and imgur API lookups. It
+// claims the next free turn on the host of target and waits for it, without
+// holding up lookups on other hosts.
+func (c *converter) waitLookup(target string) error {
+	host := target
+	if u, err := url.Parse(target); err == nil && u.Host != "" {
+		host = strings.ToLower(u.Hostname())
+	}
+
+	lookups.Lock()
+	turn := time.Now()
+	if next := lookups.last[host].Add(c.resolveEvery); next.After(turn) {
+		turn = next
+	}
+	lookups.last[host] = turn
+	lookups.Unlock()
+
+	wait := time.Until(turn)
+	if wait <= 0 {
+		return nil
+	}
+	stage("resolve", fmt.Sprintf(tr("waiting %s before the next lookup on %s"), wait.Round(time.Millisecond), host))
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-shutdownCtx.Done():
+		return shutdownCtx.Err()
+	}
+}
+
+// cachedResolve returns the answer of an earlier lookup of a page
+func cachedResolve(source string) (string, bool) {
+	resolved.Lock()
+	defer resolved.Unlock()
+	src, ok := resolved.urls[source]
+
+	return src, ok
+}
+
+func storeResolve(source, media string) {
+	resolved.Lock()
+	defer resolved.Unlock()
+	resolved.urls[source] = media
+}
+
+// resolveSource finds the media URL behind a page URL with the first
+// matching rule of the resolvers file, otherwise by asking the resolver
+// plugins. The first plugin to answer wins; without one the URL is used as
+// is. Lookups on the same host are spaced by -resolve-interval.
+func (c *converter) resolveSource(source string) (string, error) {
+	rules, err := findResolverRules()
+	if err != nil {
+		return "", err
+	}
+	rule, target := matchRule(rules, source)
+	if rule != nil && !rule.fetches() {
+		return target, nil
+	}
+	plugins := findResolverPlugins()
+	if rule == nil && len(plugins) == 0 {
+		return source, nil
+	}
+
+	// The cache is not locked during lookups, which may take long
+	if src, ok := cachedResolve(source); ok {
+		return src, nil
+	}
+
+	if rule != nil {
+		media, err := c.resolveFetch(rule, target)
+		if err != nil {
+			return "", errors.New(rule.Name + ": " + err.Error())
+		}
+		storeResolve(source, media)
+		return media, nil
+	}
+	// Plugins are expected to ask the host of the page
+	err = c.waitLookup(source)
+	if err != nil {
+		return "", err
+	}
+	for _, plugin := range plugins {
+		ctx, cancel := context.WithTimeout(shutdownCtx, c.timeout)
+		resp, err := callPlugin(ctx, plugin, resolverPluginRequest{URL: source})
+		cancel()
+		if err != nil {
+			return "", err
+		}
+		if resp.URL != "" {
+			storeResolve(source, resp.URL)
+			return resp.URL, nil
+		}
+	}
+
+	storeResolve(source, source)
+	return source, nil
+}
+
+// callPlugin runs a plugin with request as its JSON input
+func callPlugin(ctx context.Context, plugin string, request interface{}) (*pluginResponse, error) {
+	input, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, plugin)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	name := filepath.Base(plugin)
+	err = cmd.Run()
+	if err != nil {
+		return nil, errors.New(fmt.Sprint(name, ": ", err, ": ", strings.TrimSpace(stderr.String())))
+	}
+
+	var resp pluginResponse
+	err = json.Unmarshal(stdout.Bytes(), &resp)
+	if err != nil {
+		return nil, errors.New(name + " returned invalid JSON: " + err.Error())
+	}
+	if resp.Error != "" {
+		return nil, errors.New(name + ": " + resp.Error)
+	}
+
+	return &resp, nil
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// outputPreset describes the constraints of a platform. Conversions start
+// with the first tuning and move down the list until the output is small
+// enough.
+type outputPreset struct {
+	name   string
+	format string
+	// scale replaces the scaling filters, if set
+	scale       string
+	maxSize     int64
+	maxDuration time.Duration
+	// maxFrames limits the number of frames, the longest clip depends on
+	// the frame rate of the tuning
+	maxFrames int
+	noAudio   bool
+	tunings   []presetTuning
+}
+
+type presetTuning struct {
+	frameRate int
+	// colors limits the GIF palette, zero keeps all 256
+	colors int
+	// crf is the quality of mp4 and webm outputs
+	crf int
+}
+
+var presets = map[string]*outputPreset{
+	// Slack custom emoji are shown at 128x128, must stay below 128KB and
+	// are not animated past 50 frames
+	"slack-emoji": {
+		name:      "slack-emoji",
+		format:    "gif",
+		scale:     `crop=min(iw\,ih):min(iw\,ih),scale=128:128`,
+		maxSize:   128 << 10,
+		maxFrames: 50,
+		noAudio:   true,
+		tunings: []presetTuning{
+			{frameRate: 15},
+			{frameRate: 12},
+			{frameRate: 12, colors: 128},
+			{frameRate: 10, colors: 128},
+			{frameRate: 10, colors: 64},
+			{frameRate: 8, colors: 64},
+			{frameRate: 6, colors: 32},
+		},
+	},
+	// Telegram video stickers are VP9 webm files with one side of 512
+	// pixels, at most 3 seconds and 30 fps, and below 256KB
+	"telegram-sticker": {
+		name:        "telegram-sticker",
+		format:      "webm",
+		scale:       "scale=512:512:force_original_aspect_ratio=decrease:force_divisible_by=2",
+		maxSize:     256 << 10,
+		maxDuration: 3 * time.Second,
+		noAudio:     true,
+		tunings: []presetTuning{
+			{frameRate: 30, crf: 33},
+			{frameRate: 30, crf: 40},
+			{frameRate: 24, crf: 45},
+			{frameRate: 20, crf: 50},
+			{frameRate: 15, crf: 55},
+			{frameRate: 15, crf: 63},
+		},
+	},
+}
+
+func presetNames() string {
+	var names []string
+	for name := range presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return strings.Join(names, ", ")
+}
+
+// applyPreset replaces the format and width options with those of the preset
+func (c *converter) applyPreset() error {
+	if c.presetName == "" {
+		return nil
+	}
+
+	p, ok := presets[c.presetName]
+	if !ok {
+		return errors.New("Unknown preset " + c.presetName + ", expected one of " + presetNames())
+	}
+	if len(c.widths) > 1 {
+		return errors.New("-widths cannot be combined with -preset")
+	}
+
+	c.preset = p
+	c.format = p.format
+	c.tuning = 0
+
+	return nil
+}
+
+// tuned returns the current tuning of the preset
+func (c *converter) tuned() presetTuning {
+	return c.preset.tunings[c.tuning]
+}
+
+// maxLength returns the longest output the preset allows at the current
+// tuning, or zero if it has no limit
+func (c *converter) maxLength() time.Duration {
+	length := c.preset.maxDuration
+	if c.preset.maxFrames > 0 {
+		frames := time.Duration(c.preset.maxFrames) * time.Second / time.Duration(c.tuned().frameRate)
+		if length == 0 || frames < length {
+			length = frames
+		}
+	}
+
+	return length
+}
+
+// presetFilter limits the frame rate to the current tuning
+func (c *converter) presetFilter() string {
+	return "fps=" + strconv.Itoa(c.tuned().frameRate)
+}
+
+// retune moves to the next, smaller tuning when the output exceeds the
+// preset's size limit. It reports whether the output has to be converted
+// again.
+func (c *converter) retune() (bool, error) {
+	size := fileSize(c.outputImage)
+	if c.preset == nil {
+		// Outputs too large to upload fall back to the upload limit's tunings
+		limit := c.uploadLimit()
+		if c.onLimit != "retune" || limit == 0 || size <= limit {
+			return false, nil
+		}
+		c.preset = limitPreset(c.uploader, c.format, limit)
+		c.tuning = 0
+		stage("retune", fmt.Sprintf(tr("%s is %dKB, over the %dKB %s upload limit"), c.outputImage, size>>10, limit>>10, c.uploader))
+		return true, nil
+	}
+
+	if size <= c.preset.maxSize {
+		return false, nil
+	}
+	if c.tuning == len(c.preset.tunings)-1 {
+		return false, fmt.Errorf(tr("Output is %dKB, over the %dKB limit of %s even at the lowest settings; try a shorter -trim"), size>>10, c.preset.maxSize>>10, c.preset.name)
+	}
+
+	c.tuning++
+	return true, nil
+}
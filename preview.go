@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Previews trade quality for speed, a few seconds of ffmpeg even for long
+// sources
+const (
+	previewFileName = "preview"
+	previewWidth    = 160
+	previewRate     = 5
+	previewColors   = 32
+)
+
+var errPreviewDeclined = errors.New("Not converted after the preview")
+
+// confirmPreview renders a tiny, low frame rate GIF of the part of the
+// source that would be converted and asks whether to go on with the full
+// conversion
+func (c *converter) confirmPreview() error {
+	if c.meta.Still {
+		return nil
+	}
+
+	preview := c.tempPath(previewFileName + c.suffix() + ".gif")
+	filters := append(c.frameFilters(), c.rotationFilters()...)
+	filters = append(filters,
+		fmt.Sprintf("fps=%d,scale=%d:-2:flags=fast_bilinear", previewRate, previewWidth),
+		fmt.Sprintf("split[a][b];[a]palettegen=max_colors=%d[p];[b][p]paletteuse=dither=none", previewColors))
+	args := append(c.inputArgs(), "-vf", strings.Join(filters, ","), "-an", "-y", preview)
+	err := runFFmpeg("preview", c.trimmedDuration(), args)
+	if err != nil {
+		return err
+	}
+
+	question := fmt.Sprintf(tr("Preview of %s: %s\nConvert it at full quality? [y/N] "), c.startImage, preview)
+	answer, err := progressLine.prompt(question)
+	if err != nil {
+		return err
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return nil
+	}
+
+	return errPreviewDeclined
+}
+
+// validatePreview makes sure there is someone to answer the prompts of
+// -preview-first
+func (c *converter) validatePreview() error {
+	if c.previewFirst && !isTerminal(os.Stdin) {
+		return errors.New("-preview-first asks before each conversion and needs an interactive terminal")
+	}
+
+	return nil
+}
+
+// prompt asks a question on stderr and reads the answer from stdin. The
+// status line is kept from drawing over the question until it is answered.
+func (s *statusLine) prompt(question string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.clear()
+	fmt.Fprint(os.Stderr, question)
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+
+	return line, nil
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// mediaInfo is the subset of ffprobe output used during conversion. Stream
+// fields describe the first video stream.
+type mediaInfo struct {
+	Title        string
+	CreationTime time.Time
+	Duration     time.Duration
+	Bitrate      int64
+	Codec        string
+	Width        int
+	Height       int
+	FrameRate    float64
+	// Rotation is the clockwise rotation needed for display: 0, 90, 180 or 270
+	Rotation int
+	// HDR is set for PQ and HLG sources, which need tone mapping to look right
+	HDR bool
+	// Still is set for single images such as PNG and JPEG files
+	Still bool
+	// AudioOnly is set for sources without a video stream, such as podcasts
+	AudioOnly bool
+}
+
+type ffprobeStream struct {
+	CodecType     string            `json:"codec_type"`
+	CodecName     string            `json:"codec_name"`
+	Width         int               `json:"width"`
+	Height        int               `json:"height"`
+	AvgFrameRate  string            `json:"avg_frame_rate"`
+	RFrameRate    string            `json:"r_frame_rate"`
+	PixFmt        string            `json:"pix_fmt"`
+	ColorTransfer string            `json:"color_transfer"`
+	ColorPrimary  string            `json:"color_primaries"`
+	Tags          map[string]string `json:"tags"`
+	SideDataList  []struct {
+		Rotation float64 `json:"rotation"`
+	} `json:"side_data_list"`
+	Disposition struct {
+		AttachedPic int `json:"attached_pic"`
+	} `json:"disposition"`
+}
+
+type ffprobeOutput struct {
+	Format struct {
+		FormatName string            `json:"format_name"`
+		Duration   string            `json:"duration"`
+		BitRate    string            `json:"bit_rate"`
+		Tags       map[string]string `json:"tags"`
+	} `json:"format"`
+	Streams []ffprobeStream `json:"streams"`
+}
+
+// probe reads the metadata of a local file or URL with ffprobe
+func probe(ctx context.Context, file string) (*mediaInfo, error) {
+	cmd := exec.CommandContext(ctx, "ffprobe", "-v", "error", "-print_format", "json", "-show_format", "-show_streams", file)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if err != nil {
+		return nil, errors.New(fmt.Sprint(err) + ": " + stderr.String())
+	}
+
+	var out ffprobeOutput
+	err = json.Unmarshal(stdout.Bytes(), &out)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &mediaInfo{
+		Title: tag(out.Format.Tags, "title"),
+		// Images are read by the image2 demuxer, or a *_pipe one from URLs
+		Still: out.Format.FormatName == "image2" || strings.HasSuffix(out.Format.FormatName, "_pipe"),
+	}
+	if seconds, err := strconv.ParseFloat(out.Format.Duration, 64); err == nil {
+		info.Duration = time.Duration(seconds * float64(time.Second))
+	}
+	info.Bitrate, _ = strconv.ParseInt(out.Format.BitRate, 10, 64)
+	if created := tag(out.Format.Tags, "creation_time"); created != "" {
+		info.CreationTime, _ = time.Parse(time.RFC3339Nano, created)
+	}
+
+	hasAudio, hasVideo := false, false
+	for _, stream := range out.Streams {
+		if stream.CodecType == "audio" {
+			hasAudio = true
+		}
+		// Cover art of audio files is stored as a single frame video stream
+		if stream.CodecType != "video" || stream.Disposition.AttachedPic != 0 || hasVideo {
+			continue
+		}
+		hasVideo = true
+		info.Codec = stream.CodecName
+		info.Width = stream.Width
+		info.Height = stream.Height
+		info.FrameRate = parseRate(stream.AvgFrameRate)
+		if info.FrameRate == 0 {
+			info.FrameRate = parseRate(stream.RFrameRate)
+		}
+		info.Rotation = stream.rotation()
+		info.HDR = stream.hdr()
+	}
+	info.AudioOnly = hasAudio && !hasVideo
+
+	return info, nil
+}
+
+// rotation reads the display rotation from the display matrix side data,
+// falling back to the rotate tag written by older muxers
+func (s ffprobeStream) rotation() int {
+	degrees := 0
+	if rotate := tag(s.Tags, "rotate"); rotate != "" {
+		degrees, _ = strconv.Atoi(rotate)
+	}
+	for _, side := range s.SideDataList {
+		if side.Rotation != 0 {
+			// The display matrix rotation is counter clockwise
+			degrees = -int(math.Round(side.Rotation))
+		}
+	}
+
+	degrees %= 360
+	if degrees < 0 {
+		degrees += 360
+	}
+
+	return degrees
+}
+
+// hdr reports whether the stream uses an HDR transfer function, or is a high
+// bit depth BT.2020 stream that is tagged without one
+func (s ffprobeStream) hdr() bool {
+	switch s.ColorTransfer {
+	case "smpte2084", "arib-std-b67":
+		return true
+	}
+
+	highBitDepth := strings.Contains(s.PixFmt, "10") || strings.Contains(s.PixFmt, "12")
+	return highBitDepth && strings.HasPrefix(s.ColorPrimary, "bt2020")
+}
+
+// Tone map to SDR BT.709 in linear light. Requires ffmpeg built with libzimg.
+const tonemapFilter = "zscale=t=linear:npl=100,format=gbrpf32le,zscale=p=bt709,tonemap=tonemap=hable:desat=0,zscale=t=bt709:m=bt709:r=tv,format=yuv420p"
+
+// rotationFilters returns the ffmpeg filters that turn the video upright
+func (m *mediaInfo) rotationFilters() []string {
+	switch m.Rotation {
+	case 90:
+		return []string{"transpose=clock"}
+	case 180:
+		return []string{"hflip", "vflip"}
+	case 270:
+		return []string{"transpose=cclock"}
+	}
+
+	return nil
+}
+
+// parseRate parses an ffprobe rational such as 30000/1001
+func parseRate(rate string) float64 {
+	num, den, ok := strings.Cut(rate, "/")
+	if !ok {
+		f, _ := strconv.ParseFloat(rate, 64)
+		return f
+	}
+
+	n, err1 := strconv.ParseFloat(num, 64)
+	d, err2 := strconv.ParseFloat(den, 64)
+	if err1 != nil || err2 != nil || d == 0 {
+		return 0
+	}
+
+	return n / d
+}
+
+// probeCommand prints the metadata of a source as JSON
+func probeCommand(args []string) error {
+	if len(args) != 1 {
+		return errors.New("Usage: go-gif-pr probe <url or path>")
+	}
+
+	info, err := probe(shutdownCtx, args[0])
+	if err != nil {
+		return err
+	}
+
+	out := struct {
+		Title        string    `json:"title,omitempty"`
+		CreationTime time.Time `json:"creation_time"`
+		Duration     float64   `json:"duration_seconds"`
+		Bitrate      int64     `json:"bitrate"`
+		Codec        string    `json:"codec"`
+		Width        int       `json:"width"`
+		Height       int       `json:"height"`
+		FrameRate    float64   `json:"frame_rate"`
+		Rotation     int       `json:"rotation"`
+		HDR          bool      `json:"hdr"`
+		Still        bool      `json:"still"`
+		AudioOnly    bool      `json:"audio_only"`
+	}{info.Title, info.CreationTime, info.Duration.Seconds(), info.Bitrate, info.Codec, info.Width, info.Height, info.FrameRate, info.Rotation, info.HDR, info.Still, info.AudioOnly}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+// tag looks up a metadata tag, whose key case differs between containers
+func tag(tags map[string]string, key string) string {
+	for k, v := range tags {
+		if strings.EqualFold(k, key) {
+			return strings.TrimSpace(v)
+		}
+	}
+
+	return ""
+}
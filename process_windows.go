@@ -0,0 +1,26 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// processAlive reports whether a process with the ID is running. Finding a
+// process opens it on Windows, which fails once it has exited. Processes of
+// other users or elevated ones cannot be opened but are still running.
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	p, err := os.FindProcess(pid)
+	if errors.Is(err, syscall.ERROR_ACCESS_DENIED) {
+		return true
+	}
+	if err != nil {
+		return false
+	}
+	p.Release()
+
+	return true
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var spinnerFrames = []string{"|", "/", "-", "\\"}
+
+// activity is a running stage shown on the status line
+type activity struct {
+	name     string
+	start    time.Time
+	progress float64
+}
+
+// statusLine redraws a single line on stderr showing a spinner, the elapsed
+// time and, where known, the progress and ETA of every active stage. It is
+// only drawn when stderr is a terminal.
+type statusLine struct {
+	mu      sync.Mutex
+	enabled bool
+	active  []*activity
+	frame   int
+	drawn   bool
+	stop    chan struct{}
+}
+
+var progressLine = &statusLine{}
+
+func setupStatusLine() {
+	progressLine.enabled = isTerminal(os.Stderr)
+}
+
+// beginStage adds a stage to the status line until end is called
+func beginStage(name string) *activity {
+	a := &activity{name: name, start: time.Now(), progress: -1}
+
+	progressLine.mu.Lock()
+	defer progressLine.mu.Unlock()
+
+	progressLine.active = append(progressLine.active, a)
+	if progressLine.enabled && progressLine.stop == nil {
+		progressLine.stop = make(chan struct{})
+		go progressLine.run(progressLine.stop)
+	}
+
+	return a
+}
+
+// setProgress records the completed fraction of the stage, from 0 to 1
+func (a *activity) setProgress(p float64) {
+	progressLine.mu.Lock()
+	defer progressLine.mu.Unlock()
+
+	a.progress = p
+}
+
+func (a *activity) end() {
+	progressLine.mu.Lock()
+	defer progressLine.mu.Unlock()
+
+	for i, other := range progressLine.active {
+		if other == a {
+			progressLine.active = append(progressLine.active[:i], progressLine.active[i+1:]...)
+			break
+		}
+	}
+	if len(progressLine.active) == 0 {
+		progressLine.clear()
+		if progressLine.stop != nil {
+			close(progressLine.stop)
+			progressLine.stop = nil
+		}
+	}
+}
+
+func (s *statusLine) run(stop chan struct{}) {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			s.mu.Lock()
+			// Check again under the lock, end may have cleared the line
+			select {
+			case <-stop:
+			default:
+				s.draw()
+			}
+			s.mu.Unlock()
+		}
+	}
+}
+
+func (s *statusLine) draw() {
+	if len(s.active) == 0 {
+		return
+	}
+
+	s.frame = (s.frame + 1) % len(spinnerFrames)
+	parts := make([]string, len(s.active))
+	for i, a := range s.active {
+		elapsed := time.Since(a.start)
+		parts[i] = a.name + " " + formatClock(elapsed)
+		if a.progress > 0 {
+			eta := time.Duration(float64(elapsed) * (1 - a.progress) / a.progress)
+			parts[i] += fmt.Sprintf(" %3.0f%% ETA %s", a.progress*100, formatClock(eta))
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "\r\x1b[K%s %s", spinnerFrames[s.frame], strings.Join(parts, " | "))
+	s.drawn = true
+}
+
+func (s *statusLine) clear() {
+	if s.drawn {
+		fmt.Fprint(os.Stderr, "\r\x1b[K")
+		s.drawn = false
+	}
+}
+
+// println writes a line to w without it being mixed into the status line
+func (s *statusLine) println(w io.Writer, line string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.clear()
+	fmt.Fprintln(w, line)
+}
+
+func formatClock(d time.Duration) string {
+	d = d.Round(time.Second)
+	return fmt.Sprintf("%02d:%02d", int(d.Minutes()), int(d.Seconds())%60)
+}
+
+// progressReader reports how much of an expected total has been read
+type progressReader struct {
+	r      io.Reader
+	act    *activity
+	total  int64
+	copied int64
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.copied += int64(n)
+	if p.total > 0 {
+		p.act.setProgress(float64(p.copied) / float64(p.total))
+	}
+
+	return n, err
+}
+
+// watchFFmpegProgress reads the key=value lines written by ffmpeg's
+// -progress option and reports out_time against the expected duration
+func watchFFmpegProgress(r io.Reader, act *activity, total time.Duration) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), "=")
+		if !ok || key != "out_time_us" || total <= 0 {
+			continue
+		}
+
+		us, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || us < 0 {
+			continue
+		}
+		p := float64(time.Duration(us)*time.Microsecond) / float64(total)
+		if p > 1 {
+			p = 1
+		}
+		act.setProgress(p)
+	}
+}
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+)
+
+// framesDirName holds the frames of an output while a -quantizer other than
+// ffmpeg's builds the GIF
+const framesDirName = "temp_frames"
+
+// Frames are written at the source frame rate, up to the fastest rate GIF
+// delays can express reliably
+const quantizerMaxRate = 50
+
+func (c *converter) validateQuantizer() error {
+	switch c.quantizer {
+	case "", "palettegen", "mediancut":
+	case "gifski":
+		if _, err := exec.LookPath("gifski"); err != nil {
+			return errors.New("-quantizer gifski needs gifski on PATH, see https://gif.ski")
+		}
+	default:
+		return errors.New("-quantizer must be palettegen, mediancut or gifski")
+	}
+
+	return nil
+}
+
+// framesQuantized reports whether ffmpeg writes the frames of the output
+// for another quantizer instead of encoding the GIF itself
+func (c *converter) framesQuantized() bool {
+	return c.format == "gif" && (c.quantizer == "mediancut" || c.quantizer == "gifski")
+}
+
+// framesDir is the directory of the frames of the output
+func (c *converter) framesDir() string {
+	return c.tempPath(framesDirName + c.suffix() + "-" + c.imageWidth)
+}
+
+// frameRate is the constant rate the frames are written at
+func (c *converter) frameRate() int {
+	rate := quantizerMaxRate
+	switch {
+	case c.preset != nil:
+		rate = c.tuned().frameRate
+	case c.interpolate > 0:
+		rate = c.interpolate
+	case c.meta != nil && c.meta.FrameRate > 0:
+		rate = int(math.Round(c.meta.FrameRate * c.speed))
+	}
+
+	return max(1, min(rate, quantizerMaxRate))
+}
+
+// ffmpegOutput returns the output arguments of ffmpeg: the output file, or
+// a numbered PNG per frame for the quantizer
+func (c *converter) ffmpegOutput() ([]string, error) {
+	if !c.framesQuantized() {
+		return []string{c.outputImage}, nil
+	}
+
+	dir := c.framesDir()
+	os.RemoveAll(dir)
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+
+	return []string{"-r", strconv.Itoa(c.frameRate()), "-f", "image2", filepath.Join(dir, "%05d.png")}, nil
+}
+
+// quantize builds the GIF output from the frames ffmpeg wrote
+func (c *converter) quantize() error {
+	if !c.framesQuantized() {
+		return nil
+	}
+	dir := c.framesDir()
+	defer os.RemoveAll(dir)
+
+	frames, err := filepath.Glob(filepath.Join(dir, "*.png"))
+	if err != nil {
+		return err
+	}
+	if len(frames) == 0 {
+		return errors.New("ffmpeg wrote no frames to quantize")
+	}
+	sort.Strings(frames)
+
+	act := beginStage("quantize")
+	defer act.end()
+
+	if c.quantizer == "gifski" {
+		args := append([]string{"--quiet", "--fps", strconv.Itoa(c.frameRate()), "--output", c.outputImage}, frames...)
+		cmd := exec.CommandContext(shutdownCtx, "gifski", args...)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		err = cmd.Run()
+		if err != nil {
+			return errors.New(fmt.Sprint("gifski: ", err, ": ", stderr.String()))
+		}
+		return nil
+	}
+
+	colors := 256
+	if c.preset != nil && c.tuned().colors > 0 {
+		colors = c.tuned().colors
+	}
+	// Dithering speckles the flat backgrounds around text
+	return quantizeMedianCut(frames, c.outputImage, c.frameRate(), colors, !c.textMode)
+}
+
+func readPNG(name string) (image.Image, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return png.Decode(f)
+}
+
+// quantizeMedianCut encodes the frames as a GIF with a single palette,
+// chosen by median cut over a sample of the pixels of every frame
+func quantizeMedianCut(frames []string, output string, rate, colors int, dither bool) error {
+	// About a million pixels in total are enough for the palette
+	var histogram [1 << 15]int
+	var bounds image.Rectangle
+	for _, name := range frames {
+		img, err := readPNG(name)
+		if err != nil {
+			return err
+		}
+		bounds = img.Bounds()
+		step := max(1, bounds.Dx()*bounds.Dy()*len(frames)/(1<<20))
+		i := 0
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				if i%step == 0 {
+					r, g, b, _ := img.At(x, y).RGBA()
+					histogram[r>>11<<10|g>>11<<5|b>>11]++
+				}
+				i++
+			}
+		}
+	}
+	palette := medianCut(histogram[:], colors)
+
+	delay := int(math.Round(100 / float64(rate)))
+	anim := &gif.GIF{}
+	lookup := newPaletteLookup(palette)
+	for _, name := range frames {
+		img, err := readPNG(name)
+		if err != nil {
+			return err
+		}
+		anim.Image = append(anim.Image, lookup.paletted(img, dither))
+		anim.Delay = append(anim.Delay, delay)
+	}
+
+	f, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	err = gif.EncodeAll(f, anim)
+	if err != nil {
+		return err
+	}
+
+	return f.Close()
+}
+
+// colorBox is a box of the 5 bit per channel color cube with the colors of
+// the histogram that fall into it
+type colorBox struct {
+	colors []int
+	count  int
+}
+
+func channels(c int) [3]int {
+	return [3]int{c >> 10, c >> 5 & 31, c & 31}
+}
+
+// widest returns the channel with the largest range in the box, and the range
+func (b *colorBox) widest() (int, int) {
+	lo, hi := [3]int{31, 31, 31}, [3]int{}
+	for _, c := range b.colors {
+		ch := channels(c)
+		for i := range ch {
+			lo[i], hi[i] = min(lo[i], ch[i]), max(hi[i], ch[i])
+		}
+	}
+	channel := 0
+	for i := 1; i < 3; i++ {
+		if hi[i]-lo[i] > hi[channel]-lo[channel] {
+			channel = i
+		}
+	}
+
+	return channel, hi[channel] - lo[channel]
+}
+
+// medianCut splits the color cube until there are as many boxes as colors,
+// each time halving the most populated box that can still be split
+func medianCut(histogram []int, colors int) color.Palette {
+	all := &colorBox{}
+	for c, n := range histogram {
+		if n > 0 {
+			all.colors = append(all.colors, c)
+			all.count += n
+		}
+	}
+	boxes := []*colorBox{all}
+
+	for len(boxes) < colors {
+		best, channel := -1, 0
+		for i, b := range boxes {
+			ch, width := b.widest()
+			if width > 0 && (best < 0 || b.count > boxes[best].count) {
+				best, channel = i, ch
+			}
+		}
+		if best < 0 {
+			break
+		}
+
+		b := boxes[best]
+		sort.Slice(b.colors, func(i, j int) bool {
+			return channels(b.colors[i])[channel] < channels(b.colors[j])[channel]
+		})
+		// Split at the median pixel, keeping a color on each side
+		half, split := 0, 1
+		for i, c := range b.colors[:len(b.colors)-1] {
+			half += histogram[c]
+			split = i + 1
+			if half*2 >= b.count {
+				break
+			}
+		}
+		left, right := &colorBox{colors: b.colors[:split]}, &colorBox{colors: b.colors[split:]}
+		for _, c := range left.colors {
+			left.count += histogram[c]
+		}
+		right.count = b.count - left.count
+		boxes[best] = left
+		boxes = append(boxes, right)
+	}
+
+	var palette color.Palette
+	for _, b := range boxes {
+		var sum [3]int
+		for _, c := range b.colors {
+			ch := channels(c)
+			for i := range ch {
+				sum[i] += (ch[i]<<3 | ch[i]>>2) * histogram[c]
+			}
+		}
+		if b.count == 0 {
+			continue
+		}
+		palette = append(palette, color.RGBA{uint8(sum[0] / b.count), uint8(sum[1] / b.count), uint8(sum[2] / b.count), 255})
+	}
+	if len(palette) == 0 {
+		palette = color.Palette{color.RGBA{0, 0, 0, 255}}
+	}
+
+	return palette
+}
+
+// paletteLookup maps colors to their nearest palette entry, memoized by 5
+// bit color
+type paletteLookup struct {
+	palette color.Palette
+	index   [1 << 15]int16
+}
+
+func newPaletteLookup(palette color.Palette) *paletteLookup {
+	l := &paletteLookup{palette: palette}
+	for i := range l.index {
+		l.index[i] = -1
+	}
+
+	return l
+}
+
+func (l *paletteLookup) nearest(r, g, b int) int {
+	r, g, b = clampChannel(r), clampChannel(g), clampChannel(b)
+	key := r>>3<<10 | g>>3<<5 | b>>3
+	if i := l.index[key]; i >= 0 {
+		return int(i)
+	}
+	i := l.palette.Index(color.RGBA{uint8(r), uint8(g), uint8(b), 255})
+	l.index[key] = int16(i)
+
+	return i
+}
+
+func clampChannel(v int) int {
+	return max(0, min(v, 255))
+}
+
+// paletted maps a frame to the palette, diffusing the error of each pixel
+// onto its neighbours (Floyd-Steinberg) when dithering
+func (l *paletteLookup) paletted(img image.Image, dither bool) *image.Paletted {
+	bounds := img.Bounds()
+	out := image.NewPaletted(bounds, l.palette)
+	width := bounds.Dx()
+	// Errors of the current and next row, three channels per pixel
+	current, next := make([]int, (width+2)*3), make([]int, (width+2)*3)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			cr, cg, cb, _ := img.At(x, y).RGBA()
+			e := (x - bounds.Min.X + 1) * 3
+			r, g, b := int(cr>>8)+current[e]/16, int(cg>>8)+current[e+1]/16, int(cb>>8)+current[e+2]/16
+			i := l.nearest(r, g, b)
+			out.SetColorIndex(x, y, uint8(i))
+			if !dither {
+				continue
+			}
+
+			// Palettes from elsewhere may hold any color type
+			p := color.RGBAModel.Convert(l.palette[i]).(color.RGBA)
+			for ch, diff := range [3]int{r - int(p.R), g - int(p.G), b - int(p.B)} {
+				current[e+3+ch] += diff * 7
+				next[e-3+ch] += diff * 3
+				next[e+ch] += diff * 5
+				next[e+3+ch] += diff
+			}
+		}
+		current, next = next, current
+		for i := range next {
+			next[i] = 0
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// byteRate is a transfer rate in bytes per second. It implements flag.Value
+// and accepts values such as 500KB/s, 2MB/s or 1M.
+type byteRate int64
+
+var rateUnits = map[string]int64{
+	"":   1,
+	"B":  1,
+	"K":  1 << 10,
+	"KB": 1 << 10,
+	"M":  1 << 20,
+	"MB": 1 << 20,
+	"G":  1 << 30,
+	"GB": 1 << 30,
+}
+
+func (r *byteRate) String() string {
+	if *r == 0 {
+		return ""
+	}
+
+	return strconv.FormatInt(int64(*r), 10) + "B/s"
+}
+
+func (r *byteRate) Set(value string) error {
+	n, err := parseBytes(strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(value)), "/S"))
+	if err != nil {
+		return errors.New("invalid rate " + value)
+	}
+
+	*r = byteRate(n)
+	return nil
+}
+
+// byteSize is a number of bytes such as 10MB. It implements flag.Value.
+type byteSize int64
+
+func (b *byteSize) String() string {
+	if *b == 0 {
+		return ""
+	}
+
+	return strconv.FormatInt(int64(*b), 10) + "B"
+}
+
+func (b *byteSize) Set(value string) error {
+	n, err := parseBytes(value)
+	if err != nil {
+		return errors.New("invalid size " + value)
+	}
+
+	*b = byteSize(n)
+	return nil
+}
+
+// parseBytes parses an amount with an optional unit from rateUnits
+func parseBytes(value string) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(value))
+
+	i := strings.IndexFunc(s, func(c rune) bool {
+		return (c < '0' || c > '9') && c != '.'
+	})
+	if i == -1 {
+		i = len(s)
+	}
+
+	unit, ok := rateUnits[strings.TrimSpace(s[i:])]
+	if !ok {
+		return 0, errors.New("unknown unit in " + value)
+	}
+
+	n, err := strconv.ParseFloat(s[:i], 64)
+	if err != nil || n < 0 {
+		return 0, errors.New("invalid amount " + value)
+	}
+
+	return int64(n * float64(unit)), nil
+}
+
+// bandwidth is the token bucket shared by every throttled transfer of the
+// process, so downloads and uploads running at the same time stay under
+// -limit-rate together rather than each on its own. Tokens are bytes;
+// they go negative while transfers wait for the bytes they already took.
+var bandwidth struct {
+	sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// takeBandwidth takes n bytes from the bucket, filled at rate bytes per
+// second, and waits until they were due. The wait ends early on shutdown.
+func takeBandwidth(rate int64, n int) error {
+	bandwidth.Lock()
+	now := time.Now()
+	if !bandwidth.last.IsZero() {
+		// At most a tenth of a second is saved up, which keeps the rate even
+		bandwidth.tokens = math.Min(bandwidth.tokens+now.Sub(bandwidth.last).Seconds()*float64(rate), float64(rate)/10)
+	}
+	bandwidth.last = now
+	bandwidth.tokens -= float64(n)
+	wait := time.Duration(-bandwidth.tokens / float64(rate) * float64(time.Second))
+	bandwidth.Unlock()
+
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-shutdownCtx.Done():
+		return shutdownCtx.Err()
+	}
+}
+
+// rateLimitedReader delays reads so that no more than rate bytes per second
+// pass through all such readers on average.
+type rateLimitedReader struct {
+	r    io.Reader
+	rate int64
+}
+
+func (l *rateLimitedReader) Read(p []byte) (int, error) {
+	// Keep individual reads small so the rate stays even
+	if max := int(l.rate / 10); max > 0 && len(p) > max {
+		p = p[:max]
+	}
+
+	n, err := l.r.Read(p)
+	if n > 0 {
+		if waitErr := takeBandwidth(l.rate, n); waitErr != nil {
+			return n, waitErr
+		}
+	}
+
+	return n, err
+}
+
+// throttle wraps r with the configured rate limit, if any
+func (c *converter) throttle(r io.Reader) io.Reader {
+	if c.limitRate <= 0 {
+		return r
+	}
+
+	return &rateLimitedReader{r: r, rate: int64(c.limitRate)}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Regions are pixelated into blocks of this many pixels
+const pixelateBlock = 12
+
+// blurRegion is an area of the source frames to pixelate, optionally only
+// between two times of the clip
+type blurRegion struct {
+	x, y, width, height int
+	start, end          string
+}
+
+// regionList collects repeated -blur-region flags. It implements flag.Value.
+type regionList []blurRegion
+
+func (r *regionList) String() string {
+	var regions []string
+	for _, region := range *r {
+		s := fmt.Sprintf("%d,%d,%dx%d", region.x, region.y, region.width, region.height)
+		if region.start != "" || region.end != "" {
+			s += "," + region.start + "-" + region.end
+		}
+		regions = append(regions, s)
+	}
+
+	return strings.Join(regions, " ")
+}
+
+// Set parses X,Y,WxH with an optional ,START-END time range
+func (r *regionList) Set(value string) error {
+	invalid := errors.New("Blur region must be given as X,Y,WxH[,START-END], e.g. 40,600,320x48,2-5: " + value)
+
+	parts := strings.Split(value, ",")
+	if len(parts) != 3 && len(parts) != 4 {
+		return invalid
+	}
+
+	var region blurRegion
+	var err1, err2, err3, err4 error
+	region.x, err1 = strconv.Atoi(strings.TrimSpace(parts[0]))
+	region.y, err2 = strconv.Atoi(strings.TrimSpace(parts[1]))
+	w, h, ok := strings.Cut(strings.TrimSpace(parts[2]), "x")
+	if !ok {
+		return invalid
+	}
+	region.width, err3 = strconv.Atoi(w)
+	region.height, err4 = strconv.Atoi(h)
+	if err1 != nil || err2 != nil || err3 != nil || err4 != nil || region.x < 0 || region.y < 0 || region.width <= 0 || region.height <= 0 {
+		return invalid
+	}
+
+	if len(parts) == 4 {
+		start, end, err := parseTrim(parts[3])
+		if err != nil {
+			return err
+		}
+		region.start, region.end = start, end
+	}
+
+	*r = append(*r, region)
+	return nil
+}
+
+// blurFilters pixelate each region by scaling a crop of it down and back up,
+// and laying it over the frame
+func (c *converter) blurFilters() []string {
+	var filters []string
+	for i, region := range c.blurRegions {
+		blocksW := max(1, region.width/pixelateBlock)
+		blocksH := max(1, region.height/pixelateBlock)
+
+		overlay := fmt.Sprintf("overlay=%d:%d", region.x, region.y)
+		if enable := region.enable(); enable != "" {
+			overlay += ":enable='" + enable + "'"
+		}
+
+		filters = append(filters, fmt.Sprintf("split[bm%[1]d][br%[1]d];[br%[1]d]crop=%[2]d:%[3]d:%[4]d:%[5]d,scale=%[6]d:%[7]d,scale=%[2]d:%[3]d:flags=neighbor[bp%[1]d];[bm%[1]d][bp%[1]d]%[8]s",
+			i, region.width, region.height, region.x, region.y, blocksW, blocksH, overlay))
+	}
+
+	return filters
+}
+
+// enable returns the timeline expression limiting the region to its time
+// range, or an empty string if it applies throughout
+func (r blurRegion) enable() string {
+	start, end := 0.0, -1.0
+	if r.start != "" {
+		d, _ := parseTimestamp(r.start)
+		start = d.Seconds()
+	}
+	if r.end != "" {
+		d, _ := parseTimestamp(r.end)
+		end = d.Seconds()
+	}
+
+	switch {
+	case end >= 0:
+		return fmt.Sprintf("between(t,%s,%s)", strconv.FormatFloat(start, 'f', -1, 64), strconv.FormatFloat(end, 'f', -1, 64))
+	case start > 0:
+		return fmt.Sprintf("gte(t,%s)", strconv.FormatFloat(start, 'f', -1, 64))
+	}
+
+	return ""
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+type reportEntry struct {
+	Source     string  `json:"source"`
+	Output     string  `json:"output,omitempty"`
+	Format     string  `json:"format"`
+	URL        string  `json:"url,omitempty"`
+	GIFV       string  `json:"gifv_url,omitempty"`
+	Alt        string  `json:"alt,omitempty"`
+	SourceSize int64   `json:"source_size"`
+	OutputSize int64   `json:"output_size"`
+	Duration   float64 `json:"duration_seconds"`
+	Status     string  `json:"status"`
+	Error      string  `json:"error,omitempty"`
+
+	Imgur    *imgurMetadata `json:"imgur,omitempty"`
+	Timings  *stageSeconds  `json:"stage_seconds,omitempty"`
+	Warnings []warning      `json:"warnings,omitempty"`
+}
+
+// imgurMetadata describes an upload as stored by imgur
+type imgurMetadata struct {
+	ID     string `json:"id"`
+	Type   string `json:"type"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Size   int64  `json:"size"`
+}
+
+// writeReport writes one entry per job to reportPath. The format is JSON
+// when the file has a .json extension and CSV otherwise.
+func writeReport(reportPath string, jobs []*converter) error {
+	var entries []reportEntry
+	for _, c := range jobs {
+		entries = append(entries, c.reportEntry())
+	}
+
+	f, err := os.Create(reportPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if strings.ToLower(filepath.Ext(reportPath)) == ".json" {
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(entries)
+	} else {
+		err = writeCSVReport(csv.NewWriter(f), entries)
+	}
+	if err != nil {
+		return err
+	}
+
+	return f.Close()
+}
+
+// reportEntry describes the outcome of a job, for reports and -json output
+func (c *converter) reportEntry() reportEntry {
+	entry := reportEntry{
+		Source:     c.startImage,
+		Output:     c.outputImage,
+		Format:     c.format,
+		Alt:        c.alt,
+		SourceSize: c.sourceSize,
+		OutputSize: c.outputSize,
+		Duration:   c.duration.Seconds(),
+		Status:     "ok",
+		Warnings:   c.warnings,
+	}
+	if c.uploaded() {
+		entry.URL = c.endImage
+		entry.GIFV = c.imgurPage
+	}
+	if c.timings != (stageTimings{}) {
+		entry.Timings = c.timings.seconds()
+	}
+	if i := c.imgurImage; i != nil {
+		entry.Imgur = &imgurMetadata{i.ID, i.Type, i.Width, i.Height, i.Size}
+	}
+	if c.err != nil {
+		entry.Status = "error"
+		entry.Error = c.err.Error()
+	}
+
+	return entry
+}
+
+func writeCSVReport(w *csv.Writer, entries []reportEntry) error {
+	w.Write([]string{"source", "output", "format", "url", "source_size", "output_size", "duration_seconds", "status", "error", "warnings"})
+	for _, e := range entries {
+		w.Write([]string{
+			e.Source,
+			e.Output,
+			e.Format,
+			e.URL,
+			strconv.FormatInt(e.SourceSize, 10),
+			strconv.FormatInt(e.OutputSize, 10),
+			strconv.FormatFloat(e.Duration, 'f', 2, 64),
+			e.Status,
+			e.Error,
+			warningMessages(e.Warnings),
+		})
+	}
+	w.Flush()
+
+	return w.Error()
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	resolversFileName = "resolvers.json"
+	resolverBodyLimit = 4 << 20
+)
+
+// resolverRule is an entry of the resolvers file, which finds the media
+// behind pages whose URL matches Match:
+//
+//	[
+//	  {"match": "^https://streamable\\.com/(\\w+)$",
+//	   "url": "https://api.streamable.com/videos/$1", "field": "files.mp4.url"},
+//	  {"match": "^https://clips\\.example\\.com/",
+//	   "extract": "<meta property=\"og:video\" content=\"([^\"]+)\""},
+//	  {"match": "^https://example\\.org/v/(\\d+)$",
+//	   "url": "https://cdn.example.org/$1.mp4"}
+//	]
+//
+// URL is expanded with the groups of Match and defaults to the page. With
+// Field the JSON at the URL is fetched and the media URL is read from the
+// dotted path, where numbers index arrays. With Extract the first group of
+// the regular expression, or its whole match, is taken from the body at
+// the URL. Without either the expanded URL is the media URL.
+type resolverRule struct {
+	Name    string `json:"name"`
+	Match   string `json:"match"`
+	URL     string `json:"url"`
+	Field   string `json:"field"`
+	Extract string `json:"extract"`
+
+	match   *regexp.Regexp
+	extract *regexp.Regexp
+}
+
+// resolversPath returns the resolvers file, GIFV_RESOLVERS_FILE if set and
+// otherwise resolvers.json in the user's configuration directory
+func resolversPath() (string, error) {
+	if path := os.Getenv("GIFV_RESOLVERS_FILE"); path != "" {
+		return path, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, keyringService, resolversFileName), nil
+}
+
+var resolverRules struct {
+	once  sync.Once
+	rules []resolverRule
+	err   error
+}
+
+// findResolverRules reads and compiles the resolvers file once. A missing
+// file has no rules.
+func findResolverRules() ([]resolverRule, error) {
+	resolverRules.once.Do(func() {
+		path, err := resolversPath()
+		if err != nil {
+			return
+		}
+		resolverRules.rules, resolverRules.err = readResolverRules(path)
+	})
+
+	return resolverRules.rules, resolverRules.err
+}
+
+func readResolverRules(path string) ([]resolverRule, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var rules []resolverRule
+	err = json.Unmarshal(data, &rules)
+	if err != nil {
+		return nil, errors.New(path + ": " + err.Error())
+	}
+	for i := range rules {
+		r := &rules[i]
+		if r.Name == "" {
+			r.Name = "resolver " + strconv.Itoa(i+1)
+		}
+		if r.Match == "" {
+			return nil, fmt.Errorf("%s: %s needs a match pattern", path, r.Name)
+		}
+		if r.Field != "" && r.Extract != "" {
+			return nil, fmt.Errorf("%s: %s can use either field or extract", path, r.Name)
+		}
+		r.match, err = regexp.Compile(r.Match)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: %v", path, r.Name, err)
+		}
+		if r.Extract != "" {
+			r.extract, err = regexp.Compile(r.Extract)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s: %v", path, r.Name, err)
+			}
+		}
+	}
+
+	return rules, nil
+}
+
+// matchRule returns the first rule matching a page and the URL it expands
+// to, or nil when no rule matches
+func matchRule(rules []resolverRule, source string) (*resolverRule, string) {
+	for i, r := range rules {
+		groups := r.match.FindStringSubmatchIndex(source)
+		if groups == nil {
+			continue
+		}
+		if r.URL == "" {
+			return &rules[i], source
+		}
+		return &rules[i], string(r.match.ExpandString(nil, r.URL, source, groups))
+	}
+
+	return nil, ""
+}
+
+// fetches reports whether the rule looks the media up, rather than only
+// rewriting the page URL
+func (r *resolverRule) fetches() bool {
+	return r.Field != "" || r.extract != nil
+}
+
+// canResolve reports whether a resolver rule or plugin may find the media
+// behind a page
+func canResolve(page string) bool {
+	if len(findResolverPlugins()) > 0 {
+		return true
+	}
+	rules, _ := findResolverRules()
+	r, _ := matchRule(rules, page)
+
+	return r != nil
+}
+
+// resolveFetch fetches the page or API response of a rule and finds the
+// media URL in it, relative to the fetched URL
+func (c *converter) resolveFetch(r *resolverRule, target string) (string, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return "", err
+	}
+	err = c.checkHost(u.Hostname())
+	if err != nil {
+		return "", err
+	}
+	err = c.waitLookup(target)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(shutdownCtx, "GET", target, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := c.fetchClient().Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s returned %s", target, resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, resolverBodyLimit))
+	if err != nil {
+		return "", err
+	}
+
+	var media string
+	if r.Field != "" {
+		var doc interface{}
+		err = json.Unmarshal(body, &doc)
+		if err != nil {
+			return "", errors.New(target + " returned invalid JSON: " + err.Error())
+		}
+		media, err = jsonField(doc, r.Field)
+		if err != nil {
+			return "", err
+		}
+	} else {
+		m := r.extract.FindSubmatch(body)
+		if m == nil {
+			return "", errors.New("no media URL found at " + target)
+		}
+		media = string(m[0])
+		if len(m) > 1 {
+			media = string(m[1])
+		}
+		media = html.UnescapeString(media)
+	}
+
+	ref, err := url.Parse(strings.TrimSpace(media))
+	if err != nil {
+		return "", err
+	}
+	return resp.Request.URL.ResolveReference(ref).String(), nil
+}
+
+// jsonField returns the string at a dotted path of a decoded JSON document
+func jsonField(doc interface{}, field string) (string, error) {
+	for _, key := range strings.Split(field, ".") {
+		switch v := doc.(type) {
+		case map[string]interface{}:
+			doc = v[key]
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(v) {
+				return "", fmt.Errorf("%s: no element %s", field, key)
+			}
+			doc = v[i]
+		default:
+			doc = nil
+		}
+		if doc == nil {
+			return "", fmt.Errorf("%s: no %s in the response", field, key)
+		}
+	}
+
+	s, ok := doc.(string)
+	if !ok || s == "" {
+		return "", fmt.Errorf("%s is not a URL in the response", field)
+	}
+
+	return s, nil
+}
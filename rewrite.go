@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"strings"
+)
+
+// urlRewrite replaces the prefix from of a link with to
+type urlRewrite struct {
+	from, to string
+}
+
+// rewriteList collects repeated -url-rewrite flags. It implements flag.Value.
+type rewriteList []urlRewrite
+
+func (r *rewriteList) String() string {
+	var rewrites []string
+	for _, rewrite := range *r {
+		rewrites = append(rewrites, rewrite.from+"=>"+rewrite.to)
+	}
+
+	return strings.Join(rewrites, " ")
+}
+
+// Set parses FROM=>TO
+func (r *rewriteList) Set(value string) error {
+	from, to, ok := strings.Cut(value, "=>")
+	from, to = strings.TrimSpace(from), strings.TrimSpace(to)
+	if !ok || from == "" {
+		return errors.New("URL rewrite must be given as FROM=>TO, e.g. https://i.imgur.com=>https://img.example.com: " + value)
+	}
+
+	*r = append(*r, urlRewrite{from, to})
+	return nil
+}
+
+// rewrite applies the first rewrite whose prefix matches link
+func (r rewriteList) rewrite(link string) string {
+	for _, rewrite := range r {
+		if strings.HasPrefix(link, rewrite.from) {
+			return rewrite.to + strings.TrimPrefix(link, rewrite.from)
+		}
+	}
+
+	return link
+}
+
+// rewriteLinks points the uploaded links at a mirror or caching proxy
+func (c *converter) rewriteLinks() {
+	if !c.uploaded() {
+		return
+	}
+
+	c.endImage = c.urlRewrites.rewrite(c.endImage)
+	if c.imgurPage != "" {
+		c.imgurPage = c.urlRewrites.rewrite(c.imgurPage)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// maxNameLength leaves room for the suffixes and extension added to output
+// names within the 255 byte limit of most file systems
+const maxNameLength = 200
+
+// Device names Windows reserves in every directory, with any extension
+var reservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// sanitizeName turns a name taken from a URL, metadata or a template into a
+// file name that is valid on every platform, since the same name is given
+// to the uploaders. Separators and characters reserved on Windows become
+// underscores, and the name cannot climb out of its directory.
+func sanitizeName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r < 0x20 || r == 0x7f || r == utf8.RuneError:
+			return '_'
+		case strings.ContainsRune(`<>:"/\|?*%`, r):
+			return '_'
+		}
+		return r
+	}, strings.TrimSpace(name))
+
+	// Leading dots hide files or climb directories, Windows drops trailing
+	// dots and spaces
+	name = strings.TrimLeft(name, ".")
+	name = strings.TrimRight(name, ". ")
+	if len(name) > maxNameLength {
+		name = name[:maxNameLength]
+		for !utf8.ValidString(name) {
+			name = name[:len(name)-1]
+		}
+		name = strings.TrimRight(name, ". ")
+	}
+	if name == "" {
+		return outputFileName
+	}
+
+	base, _, _ := strings.Cut(name, ".")
+	if reservedNames[strings.ToUpper(strings.TrimSpace(base))] {
+		name = "_" + name
+	}
+
+	return name
+}
+
+// sanitizeExt keeps an extension only if it is plain letters and digits
+func sanitizeExt(ext string) string {
+	if len(ext) < 2 || len(ext) > 8 {
+		return ""
+	}
+	for _, r := range ext[1:] {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9') {
+			return ""
+		}
+	}
+
+	return ext
+}
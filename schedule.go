@@ -0,0 +1,172 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSchedule is a standard five field crontab line: minute, hour, day of
+// month, month and day of week. Each field holds the values it matches.
+type cronSchedule struct {
+	minutes, hours, days, months, weekdays map[int]bool
+	// As in cron, an entry restricting both days of the month and of the
+	// week matches either
+	anyDay, anyWeekday bool
+}
+
+var cronFields = []struct {
+	name     string
+	min, max int
+}{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+// parseSchedule parses SPEC, e.g. */30 * * * *. Fields are lists of
+// numbers, ranges and steps; Sunday is 0 or 7.
+func parseSchedule(spec string) (*cronSchedule, error) {
+	fields := strings.Fields(spec)
+	if len(fields) != len(cronFields) {
+		return nil, errors.New("-schedule must have five fields: minute hour day-of-month month day-of-week")
+	}
+
+	var sets []map[int]bool
+	for i, field := range fields {
+		set, err := parseCronField(field, cronFields[i].min, cronFields[i].max)
+		if err != nil {
+			return nil, fmt.Errorf("-schedule %s %q: %v", cronFields[i].name, field, err)
+		}
+		sets = append(sets, set)
+	}
+	if sets[4][7] {
+		sets[4][0] = true
+	}
+
+	return &cronSchedule{
+		minutes: sets[0], hours: sets[1], days: sets[2], months: sets[3], weekdays: sets[4],
+		anyDay: fields[2] == "*", anyWeekday: fields[4] == "*",
+	}, nil
+}
+
+func parseCronField(field string, min, max int) (map[int]bool, error) {
+	set := make(map[int]bool)
+	for _, part := range strings.Split(field, ",") {
+		valueRange, stepText, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			step, err = strconv.Atoi(stepText)
+			if err != nil || step < 1 {
+				return nil, errors.New("invalid step")
+			}
+		}
+
+		start, end := min, max
+		if valueRange != "*" {
+			from, to, isRange := strings.Cut(valueRange, "-")
+			var err error
+			start, err = strconv.Atoi(from)
+			if err != nil {
+				return nil, errors.New("invalid value")
+			}
+			end = start
+			if isRange {
+				end, err = strconv.Atoi(to)
+				if err != nil {
+					return nil, errors.New("invalid range")
+				}
+			} else if hasStep {
+				end = max
+			}
+		}
+		if start < min || end > max || start > end {
+			return nil, fmt.Errorf("values must be between %d and %d", min, max)
+		}
+
+		for v := start; v <= end; v += step {
+			set[v] = true
+		}
+	}
+
+	return set, nil
+}
+
+func (s *cronSchedule) matches(t time.Time) bool {
+	if !s.minutes[t.Minute()] || !s.hours[t.Hour()] || !s.months[int(t.Month())] {
+		return false
+	}
+
+	day, weekday := s.days[t.Day()], s.weekdays[int(t.Weekday())]
+	switch {
+	case s.anyDay && s.anyWeekday:
+		return true
+	case s.anyDay:
+		return weekday
+	case s.anyWeekday:
+		return day
+	}
+	return day || weekday
+}
+
+// next returns the first matching minute after t, or the zero time if the
+// schedule never matches, such as on February 30
+func (s *cronSchedule) next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	// Every schedule repeats within a leap year cycle
+	for end := t.AddDate(5, 0, 0); t.Before(end); t = t.Add(time.Minute) {
+		if s.matches(t) {
+			return t
+		}
+	}
+
+	return time.Time{}
+}
+
+// runScheduled runs batch at every time of the schedule until shutdown,
+// delaying each run by a random part of jitter. A run that overlaps the
+// next times skips them instead of running again right away.
+func runScheduled(schedule *cronSchedule, jitter time.Duration, batch func() int) int {
+	status := 0
+	for !shuttingDown() {
+		at := schedule.next(time.Now())
+		if at.IsZero() {
+			printError(errors.New("-schedule never matches"))
+			return 1
+		}
+		if jitter > 0 {
+			at = at.Add(time.Duration(rand.Int63n(int64(jitter))))
+		}
+		stage("schedule", fmt.Sprintf(tr("next run at %s"), at.Format("2006-01-02 15:04:05")))
+
+		select {
+		case <-time.After(time.Until(at)):
+		case <-shutdownRequested:
+			return status
+		}
+
+		start := time.Now()
+		status = batch()
+		if missed := schedule.missed(start, time.Now()); missed > 0 {
+			stage("schedule", fmt.Sprintf(tr("skipped %d runs that overlapped the last one"), missed))
+		}
+	}
+
+	return status
+}
+
+// missed counts the times of the schedule between start and end
+func (s *cronSchedule) missed(start, end time.Time) int {
+	n := 0
+	for t := s.next(start); !t.IsZero() && t.Before(end); t = s.next(t) {
+		n++
+	}
+
+	return n
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type githubRelease struct {
+	ID        int64  `json:"id"`
+	TagName   string `json:"tag_name"`
+	UploadURL string `json:"upload_url"`
+	Assets    []struct {
+		Name string `json:"name"`
+		URL  string `json:"browser_download_url"`
+		Size int64  `json:"size"`
+	} `json:"assets"`
+}
+
+// releaseAsset is the address and the size of a file of a release
+type releaseAsset struct {
+	url  string
+	size int64
+}
+
+const (
+	releaseAPIEndpoint = "https://api.github.com/repos/saurori/go-gifv-pr/releases/latest"
+	releaseBinaryName  = "go-gif-pr"
+	checksumsAssetName = "checksums.txt"
+	signatureAssetName = "checksums.txt.sig"
+)
+
+// releasePublicKey is the base64 ed25519 public key that signs the
+// checksums of releases, set by the Makefile with -X main.releasePublicKey.
+// Without it a binary cannot trust any release and refuses to update.
+var releasePublicKey = ""
+
+func selfUpdate(args []string) error {
+	publicKey, err := base64.StdEncoding.DecodeString(releasePublicKey)
+	if err != nil || len(publicKey) != ed25519.PublicKeySize {
+		return errors.New("This build has no release signing key and cannot verify updates, download the release manually")
+	}
+
+	client := &http.Client{
+		Timeout: 60 * time.Second,
+	}
+
+	release, err := fetchLatestRelease(client)
+	if err != nil {
+		return err
+	}
+
+	latest, ok := parseVersion(release.TagName)
+	if !ok {
+		return errors.New("Cannot read the version of release " + release.TagName)
+	}
+	current, ok := parseVersion(version)
+	if !ok {
+		return errors.New("This build's version " + version + " cannot be compared with release " + release.TagName + ", download the release manually")
+	}
+	if !newerVersion(latest, current) {
+		fmt.Println("Already up to date:", version)
+		return nil
+	}
+
+	assetName := releaseBinaryName + "_" + runtime.GOOS + "_" + runtime.GOARCH
+	if runtime.GOOS == "windows" {
+		assetName += ".exe"
+	}
+
+	var binaryAsset, checksumsAsset, signatureAsset releaseAsset
+	for _, a := range release.Assets {
+		switch a.Name {
+		case assetName:
+			binaryAsset = releaseAsset{a.URL, a.Size}
+		case checksumsAssetName:
+			checksumsAsset = releaseAsset{a.URL, a.Size}
+		case signatureAssetName:
+			signatureAsset = releaseAsset{a.URL, a.Size}
+		}
+	}
+	if binaryAsset.url == "" {
+		return errors.New("No release asset found for " + runtime.GOOS + "/" + runtime.GOARCH)
+	}
+	if checksumsAsset.url == "" || signatureAsset.url == "" {
+		return errors.New("Release " + release.TagName + " has no signed " + checksumsAssetName)
+	}
+
+	checksums, err := download(client, checksumsAsset)
+	if err != nil {
+		return err
+	}
+	// Whoever can replace the binary can replace the checksums too, only
+	// the signature ties them to the release key
+	signature, err := download(client, signatureAsset)
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(publicKey, checksums, signature) {
+		return errors.New("The signature of " + checksumsAssetName + " in release " + release.TagName + " is invalid")
+	}
+	expected, err := findChecksum(checksums, assetName)
+	if err != nil {
+		return err
+	}
+
+	binary, err := download(client, binaryAsset)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(binary)
+	if hex.EncodeToString(sum[:]) != expected {
+		return errors.New("Checksum mismatch for " + assetName)
+	}
+
+	err = replaceExecutable(binary)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Updated %s -> %s\n", version, release.TagName)
+	return nil
+}
+
+func fetchLatestRelease(client *http.Client) (*githubRelease, error) {
+	req, err := http.NewRequest("GET", releaseAPIEndpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("User-Agent", userAgent())
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New("GitHub release lookup failed: " + resp.Status)
+	}
+
+	var release githubRelease
+	err = json.NewDecoder(resp.Body).Decode(&release)
+	if err != nil {
+		return nil, err
+	}
+
+	return &release, nil
+}
+
+// parseVersion reads the numbers of a version such as v1.2.3. Anything
+// after them, like the commits git describe appends, is ignored.
+func parseVersion(v string) ([3]int, bool) {
+	var numbers [3]int
+	v = strings.TrimPrefix(v, "v")
+	if i := strings.IndexAny(v, "-+"); i >= 0 {
+		v = v[:i]
+	}
+	parts := strings.Split(v, ".")
+	if len(parts) > len(numbers) {
+		return numbers, false
+	}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return numbers, false
+		}
+		numbers[i] = n
+	}
+
+	return numbers, true
+}
+
+// newerVersion reports whether version a is newer than version b
+func newerVersion(a, b [3]int) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return a[i] > b[i]
+		}
+	}
+
+	return false
+}
+
+// download reads a release asset, refusing to read more than the release
+// says it holds
+func download(client *http.Client, asset releaseAsset) ([]byte, error) {
+	resp, err := client.Get(asset.url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New("Download of " + asset.url + " failed: " + resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, asset.size+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) != asset.size {
+		return nil, fmt.Errorf("Download of %s has %d bytes, the release lists %d", asset.url, len(data), asset.size)
+	}
+
+	return data, nil
+}
+
+// findChecksum looks up name in a sha256sum formatted checksums file
+func findChecksum(checksums []byte, name string) (string, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(checksums))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name {
+			return strings.ToLower(fields[0]), nil
+		}
+	}
+
+	return "", errors.New("No checksum listed for " + name)
+}
+
+func replaceExecutable(binary []byte) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	exe, err = filepath.EvalSymlinks(exe)
+	if err != nil {
+		return err
+	}
+
+	// Write next to the current binary so the final rename stays on one filesystem
+	newExe := exe + ".new"
+	err = os.WriteFile(newExe, binary, 0755)
+	if err != nil {
+		return err
+	}
+
+	// Windows refuses to overwrite a running executable but allows renaming it
+	oldExe := exe + ".old"
+	os.Remove(oldExe)
+	err = os.Rename(exe, oldExe)
+	if err != nil {
+		os.Remove(newExe)
+		return err
+	}
+
+	err = os.Rename(newExe, exe)
+	if err != nil {
+		os.Rename(oldExe, exe)
+		return err
+	}
+
+	// Removing fails on Windows while the old binary is still running
+	os.Remove(oldExe)
+
+	return nil
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// exportedDownload is a cached download in an export. Its data is copied
+// to File, relative to the exported JSON, so the export never holds it.
+type exportedDownload struct {
+	cachedDownload
+	File string `json:"file"`
+}
+
+// exportDownloadsDir returns the directory the downloads of an export to
+// target are copied to, history-downloads for history.json
+func exportDownloadsDir(target string) string {
+	return strings.TrimSuffix(target, filepath.Ext(target)) + "-downloads"
+}
+
+// collectState adds the feed state, the resolver rules and, when asked for,
+// the state of an assets directory to an export. The cached downloads are
+// copied to downloadsDir, when set, and listed in the export.
+func (e *historyExport) collectState(assetsPath, downloadsDir string) error {
+	path, err := feedStatePath()
+	if err != nil {
+		return err
+	}
+	err = readState(path, &e.Feeds)
+	if err != nil {
+		return err
+	}
+
+	path, err = resolversPath()
+	if err != nil {
+		return err
+	}
+	err = readState(path, &e.Resolvers)
+	if err != nil {
+		return err
+	}
+
+	if assetsPath != "" {
+		err = readState(filepath.Join(assetsPath, assetsStateFile), &e.Assets)
+		if err != nil {
+			return err
+		}
+	}
+
+	if downloadsDir != "" {
+		cached, err := cachedDownloads()
+		if err != nil {
+			return err
+		}
+		if len(cached) > 0 {
+			err = os.MkdirAll(downloadsDir, 0700)
+			if err != nil {
+				return err
+			}
+		}
+		for _, d := range cached {
+			name := filepath.Base(d.data)
+			err = copyFile(d.data, filepath.Join(downloadsDir, name))
+			if err != nil {
+				return err
+			}
+			file := filepath.ToSlash(filepath.Join(filepath.Base(downloadsDir), name))
+			e.Downloads = append(e.Downloads, exportedDownload{cachedDownload: *d, File: file})
+		}
+	}
+
+	return nil
+}
+
+// restoreState merges the state of an export into the local one. Local
+// state wins: feeds get the entries they lack, resolver rules are added
+// when no rule has the same pattern, assets and downloads only when they
+// are not known yet. The files of the downloads are looked up relative to
+// dir, the directory of the export.
+func (e *historyExport) restoreState(assetsPath, dir string) error {
+	if len(e.Feeds) > 0 {
+		path, err := feedStatePath()
+		if err != nil {
+			return err
+		}
+		err = restoreFeeds(path, e.Feeds)
+		if err != nil {
+			return err
+		}
+	}
+	if len(e.Resolvers) > 0 {
+		path, err := resolversPath()
+		if err != nil {
+			return err
+		}
+		err = restoreResolvers(path, e.Resolvers)
+		if err != nil {
+			return err
+		}
+	}
+	if len(e.Assets) > 0 {
+		err := restoreAssets(assetsPath, e.Assets)
+		if err != nil {
+			return err
+		}
+	}
+
+	added := 0
+	for _, d := range e.Downloads {
+		ok, err := restoreDownload(d, dir)
+		if err != nil {
+			return err
+		}
+		if ok {
+			added++
+		}
+	}
+	if added > 0 {
+		base, err := downloadCacheFile("")
+		if err != nil {
+			return err
+		}
+		err = pruneDownloadCache(filepath.Dir(base))
+		if err != nil {
+			return err
+		}
+		stage("import", fmt.Sprintf(tr("%d cached downloads"), added))
+	}
+
+	return nil
+}
+
+// readState decodes a state file into v, leaving v alone when the file does
+// not exist
+func readState(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(data, v)
+	if err != nil {
+		return errors.New(path + ": " + err.Error())
+	}
+
+	return nil
+}
+
+func restoreFeeds(path string, imported map[string][]string) error {
+	state := make(map[string][]string)
+	err := readState(path, &state)
+	if err != nil {
+		return err
+	}
+	for feedURL, ids := range imported {
+		seen := make(map[string]bool)
+		for _, id := range state[feedURL] {
+			seen[id] = true
+		}
+		for _, id := range ids {
+			if !seen[id] {
+				seen[id] = true
+				state[feedURL] = append(state[feedURL], id)
+			}
+		}
+		if n := len(state[feedURL]); n > feedStateEntries {
+			state[feedURL] = state[feedURL][n-feedStateEntries:]
+		}
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return err
+	}
+
+	return writeJSON(path, state)
+}
+
+// restoreResolvers appends the imported rules whose pattern is new, after
+// checking that the merged file still compiles
+func restoreResolvers(path string, imported []json.RawMessage) error {
+	var rules []json.RawMessage
+	err := readState(path, &rules)
+	if err != nil {
+		return err
+	}
+	seen := make(map[string]bool)
+	for _, raw := range rules {
+		var rule resolverRule
+		if json.Unmarshal(raw, &rule) == nil {
+			seen[rule.Match] = true
+		}
+	}
+	for _, raw := range imported {
+		var rule resolverRule
+		err = json.Unmarshal(raw, &rule)
+		if err != nil {
+			return errors.New("resolvers: " + err.Error())
+		}
+		if !seen[rule.Match] {
+			seen[rule.Match] = true
+			rules = append(rules, raw)
+		}
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return err
+	}
+	temp := path + ".tmp" + strconv.Itoa(os.Getpid())
+	err = writeJSON(temp, rules)
+	if err != nil {
+		return err
+	}
+	_, err = readResolverRules(temp)
+	if err != nil {
+		os.Remove(temp)
+		return err
+	}
+
+	return os.Rename(temp, path)
+}
+
+// restoreAssets adds the imported sources to the state of an assets
+// directory. Their modification times differ on this machine, so the next
+// run hashes the files again and skips those with the same content.
+func restoreAssets(dir string, imported map[string]*assetState) error {
+	state := make(map[string]*assetState)
+	err := readState(filepath.Join(dir, assetsStateFile), &state)
+	if err != nil {
+		return err
+	}
+	for rel, s := range imported {
+		if _, ok := state[rel]; !ok {
+			state[rel] = s
+		}
+	}
+
+	return (&assetsDir{dir: dir, state: state}).save(nil)
+}
+
+// restoreDownload adds an imported download to the cache unless its URL is
+// cached already, and reports whether it did
+func restoreDownload(d exportedDownload, dir string) (bool, error) {
+	file := filepath.FromSlash(d.File)
+	if !filepath.IsLocal(file) {
+		return false, errors.New("Download " + d.URL + " points outside the export: " + d.File)
+	}
+	base, err := downloadCacheFile(d.URL)
+	if err != nil {
+		return false, err
+	}
+	if _, err := os.Stat(base + ".data"); err == nil {
+		return false, nil
+	}
+	err = os.MkdirAll(filepath.Dir(base), 0700)
+	if err != nil {
+		return false, err
+	}
+
+	temp := base + ".tmp" + strconv.Itoa(os.Getpid())
+	err = copyFile(filepath.Join(dir, file), temp)
+	if err != nil {
+		os.Remove(temp)
+		return false, err
+	}
+
+	return true, storeDownload(base, temp, d.cachedDownload)
+}
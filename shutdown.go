@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var errNotStarted = errors.New("Not started: shutting down")
+
+// shutdownCtx is cancelled once running work should be abandoned. External
+// commands and HTTP requests are bound to it.
+var shutdownCtx, cancelShutdown = context.WithCancel(context.Background())
+
+// shutdownRequested is closed on the first SIGINT or SIGTERM
+var shutdownRequested = make(chan struct{})
+
+// watchSignals drains on SIGINT/SIGTERM: jobs that have not started are
+// skipped while running ones get the grace period to finish. A second
+// signal or the end of the grace period cancels them.
+func watchSignals(grace time.Duration) {
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		<-signals
+		close(shutdownRequested)
+		printError(fmt.Errorf(tr("Shutting down, waiting up to %s for running jobs (signal again to abort)"), grace))
+
+		select {
+		case <-signals:
+		case <-time.After(grace):
+		}
+		cancelShutdown()
+	}()
+}
+
+func shuttingDown() bool {
+	select {
+	case <-shutdownRequested:
+		return true
+	default:
+		return false
+	}
+}
+
+// writePending saves the sources of jobs that were never started, one per
+// line, so they can be fed back in with: go-gif-pr < pending.txt
+func writePending(pendingPath string, jobs []*converter) error {
+	var sources []string
+	for _, c := range jobs {
+		if c.err == errNotStarted {
+			sources = append(sources, c.startImage)
+		}
+	}
+	if len(sources) == 0 {
+		return nil
+	}
+
+	if pendingPath == "" {
+		for _, source := range sources {
+			printError(fmt.Errorf(tr("Not started: %s"), source))
+		}
+		return nil
+	}
+
+	return os.WriteFile(pendingPath, []byte(strings.Join(sources, "\n")+"\n"), 0644)
+}
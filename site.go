@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// shortcode returns the static site generator snippet embedding the result.
+// Sites provide the gif shortcode or include themselves.
+func (c *converter) shortcode() string {
+	alt := ""
+	if c.alt != "" {
+		alt = fmt.Sprintf(" alt=%q", c.alt)
+	}
+
+	switch c.shortcodeStyle {
+	case "hugo":
+		return fmt.Sprintf(`{{< gif src=%q%s >}}`, c.endImage, alt)
+	case "jekyll":
+		return fmt.Sprintf(`{%% include gif.html src=%q%s %%}`, c.endImage, alt)
+	}
+
+	return c.endImage
+}
+
+// siteKey names the result in the site's data file, after the output file
+func (c *converter) siteKey() string {
+	name := filepath.Base(c.outputImage)
+	return strings.TrimSuffix(name, path.Ext(name))
+}
+
+// writeSiteData adds the results to a Hugo or Jekyll data file, keeping the
+// entries already in it. The file is JSON for a .json extension and YAML
+// otherwise.
+func writeSiteData(dataPath string, jobs []*converter) error {
+	data, err := readSiteData(dataPath)
+	if err != nil {
+		return errors.New(dataPath + ": " + err.Error())
+	}
+
+	for _, c := range jobs {
+		entry := map[string]string{
+			"url":    c.endImage,
+			"source": c.startImage,
+			"width":  c.imageWidth,
+		}
+		if title := c.uploadTitle(); title != "" {
+			entry["title"] = title
+		}
+		if c.alt != "" {
+			entry["alt"] = c.alt
+		}
+		data[c.siteKey()] = entry
+	}
+
+	if strings.EqualFold(filepath.Ext(dataPath), ".json") {
+		return writeJSON(dataPath, data)
+	}
+
+	return writeSiteYAML(dataPath, data)
+}
+
+func readSiteData(dataPath string) (map[string]map[string]string, error) {
+	data := make(map[string]map[string]string)
+
+	f, err := os.Open(dataPath)
+	if os.IsNotExist(err) {
+		return data, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if strings.EqualFold(filepath.Ext(dataPath), ".json") {
+		err = json.NewDecoder(f).Decode(&data)
+		return data, err
+	}
+
+	// A mapping of names to flat mappings, as written by writeSiteYAML
+	var current map[string]string
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := stripComment(scanner.Text())
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || trimmed == "---" {
+			continue
+		}
+
+		key, value, ok := strings.Cut(trimmed, ":")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected key: value", n)
+		}
+		key, err = unquote(strings.TrimSpace(key))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", n, err)
+		}
+
+		if line == strings.TrimLeft(line, " \t") {
+			current = make(map[string]string)
+			data[key] = current
+			continue
+		}
+		if current == nil {
+			return nil, fmt.Errorf("line %d: expected a top level name", n)
+		}
+		current[key], err = unquote(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", n, err)
+		}
+	}
+
+	return data, scanner.Err()
+}
+
+func writeSiteYAML(dataPath string, data map[string]map[string]string) error {
+	var names []string
+	for name := range data {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&b, "%s:\n", strconv.Quote(name))
+
+		var keys []string
+		for key := range data[name] {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fmt.Fprintf(&b, "  %s: %s\n", key, strconv.Quote(data[name][key]))
+		}
+	}
+
+	return os.WriteFile(dataPath, []byte(b.String()), 0644)
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// normalizeSource turns the inputs people paste into something fetchFile
+// understands: scheme-relative and bare host URLs become https, public S3
+// objects are fetched over https and file URLs become local paths.
+func normalizeSource(src string) (string, error) {
+	// Windows "Copy as path" quotes the path
+	if len(src) > 1 && strings.HasPrefix(src, `"`) && strings.HasSuffix(src, `"`) {
+		src = src[1 : len(src)-1]
+	}
+	// Existing files win, such as //server/share/clip.mp4 UNC paths on Windows
+	if _, err := os.Stat(src); err == nil {
+		return src, nil
+	}
+
+	if strings.HasPrefix(src, "//") {
+		return "https:" + src, nil
+	}
+
+	// Windows paths such as C:\clip.mp4 parse as a one letter scheme
+	u, err := url.Parse(src)
+	if err == nil && len(u.Scheme) > 1 {
+		switch strings.ToLower(u.Scheme) {
+		case "http", "https":
+			return strings.ToLower(u.Scheme) + src[len(u.Scheme):], nil
+		case "s3":
+			// Only public objects can be fetched, nothing is signed
+			return "https://" + u.Host + ".s3.amazonaws.com" + u.EscapedPath(), nil
+		case "file":
+			return fileURLPath(u), nil
+		}
+		return "", fmt.Errorf(tr("Unsupported source scheme %s, expected http, https, s3 or file"), u.Scheme)
+	}
+
+	if looksLikeHost(src) {
+		return "https://" + src, nil
+	}
+
+	return src, nil
+}
+
+// fileURLPath returns the local path of a file URL. On Windows a host names
+// a UNC share and file:///C:/dir/clip.mp4 is a path on drive C.
+func fileURLPath(u *url.URL) string {
+	if runtime.GOOS != "windows" {
+		return u.Path
+	}
+
+	p := u.Path
+	if len(p) > 2 && p[0] == '/' && p[2] == ':' {
+		p = p[1:]
+	}
+	if u.Host != "" && !strings.EqualFold(u.Host, "localhost") {
+		p = "//" + u.Host + p
+	}
+
+	return filepath.FromSlash(p)
+}
+
+// looksLikeHost reports whether a source that is not a local file starts
+// with a host name, as in i.imgur.com/abc.gifv
+func looksLikeHost(src string) bool {
+	host, _, ok := strings.Cut(src, "/")
+	if !ok || !strings.Contains(host, ".") || strings.HasPrefix(host, ".") {
+		return false
+	}
+
+	return !strings.ContainsAny(host, ` \:`)
+}
+
+// isRemote reports whether a normalized source is downloaded over HTTP
+func isRemote(src string) bool {
+	return strings.HasPrefix(src, "http://") || strings.HasPrefix(src, "https://")
+}
+
+// timeQueryHosts give the start time of their links in the query, as
+// ?t=1m30s, rather than in a media fragment
+const timeQueryHosts = "youtube.com,youtu.be,youtube-nocookie.com,twitch.tv"
+
+var unitTime = regexp.MustCompile(`^(?:(\d+)h)?(?:(\d+)m)?(?:(\d+(?:\.\d+)?)s)?$`)
+
+// linkTrim returns the trim range given by a timestamped link: a #t=3,8
+// media fragment, or the t, start and end query parameters of the hosts in
+// timeQueryHosts. Links without a usable time give an empty range.
+func linkTrim(src string) string {
+	src, err := normalizeSource(src)
+	if err != nil || !isRemote(src) {
+		return ""
+	}
+	u, err := url.Parse(src)
+	if err != nil {
+		return ""
+	}
+
+	var start, end string
+	if fragment, err := url.ParseQuery(u.Fragment); err == nil && fragment.Get("t") != "" {
+		start, end, _ = strings.Cut(strings.TrimPrefix(fragment.Get("t"), "npt:"), ",")
+	} else if matchHost(u.Hostname(), timeQueryHosts) {
+		query := u.Query()
+		start = query.Get("t")
+		if start == "" {
+			start = query.Get("start")
+		}
+		end = query.Get("end")
+	}
+
+	start, ok := linkSeconds(start)
+	if !ok {
+		return ""
+	}
+	end, ok = linkSeconds(end)
+	if !ok || start == "" && end == "" {
+		return ""
+	}
+
+	return start + "-" + end
+}
+
+// linkSeconds converts a time of a link, as seconds, [HH:]MM:SS or 1h2m3s,
+// to the seconds of a trim range
+func linkSeconds(t string) (string, bool) {
+	if t == "" {
+		return "", true
+	}
+	if d, err := parseTimestamp(t); err == nil {
+		return strconv.FormatFloat(d.Seconds(), 'f', -1, 64), true
+	}
+
+	m := unitTime.FindStringSubmatch(t)
+	if m == nil {
+		return "", false
+	}
+	var seconds float64
+	for i, unit := range []float64{3600, 60, 1} {
+		if n, err := strconv.ParseFloat(m[i+1], 64); err == nil {
+			seconds += n * unit
+		}
+	}
+
+	return strconv.FormatFloat(seconds, 'f', -1, 64), true
+}
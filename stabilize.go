@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+const transformsFileName = "temp_transforms"
+
+// vidstab is only available in ffmpeg builds with libvidstab; others fall
+// back to the single pass deshake filter
+var vidstab struct {
+	once      sync.Once
+	available bool
+}
+
+func hasVidstab() bool {
+	vidstab.once.Do(func() {
+		out, err := exec.Command("ffmpeg", "-hide_banner", "-filters").Output()
+		vidstab.available = err == nil && strings.Contains(string(out), " vidstabdetect ")
+	})
+	return vidstab.available
+}
+
+// detectShake runs the first vidstab pass, writing the camera motion of the
+// clip to a transforms file that the conversion then smooths out
+func (c *converter) detectShake() error {
+	if !hasVidstab() {
+		c.warn(warnNoVidstab, errors.New(tr("ffmpeg lacks vidstab, stabilizing with deshake")))
+		return nil
+	}
+
+	transforms := c.tempPath(transformsFileName + c.suffix() + ".trf")
+	filters := append(c.frameFilters(), c.rotationFilters()...)
+	filters = append(filters, "vidstabdetect=shakiness=5:accuracy=15:result="+filterPath(transforms))
+	args := append(c.inputArgs(), "-vf", strings.Join(filters, ","), "-an", "-f", "null", "-")
+	err := runFFmpeg("stabilize", c.trimmedDuration(), args)
+	if err != nil {
+		return err
+	}
+	c.transforms = transforms
+
+	return nil
+}
+
+// stabilizeFilter smooths the camera motion found by detectShake. The
+// frames are zoomed just enough to hide the moving borders.
+func (c *converter) stabilizeFilter() string {
+	if c.transforms == "" {
+		return "deshake"
+	}
+
+	return "vidstabtransform=input=" + filterPath(c.transforms) + ":smoothing=10:optzoom=1,unsharp=5:5:0.8:3:3:0.4"
+}
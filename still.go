@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Frame rate of the animation generated from a still image
+const stillFrameRate = 15
+
+// validateStill checks the options for animating still images
+func (c *converter) validateStill() error {
+	if c.stillDuration <= 0 {
+		return errors.New("-still-duration must be positive")
+	}
+	if c.zoom < 1 {
+		return errors.New("-zoom must be at least 1")
+	}
+
+	switch c.pan {
+	case "center", "left", "right", "up", "down":
+	default:
+		return errors.New("Pan must be center, left, right, up or down")
+	}
+
+	return nil
+}
+
+// zoompanFilter animates a still image with a Ken Burns style zoom from the
+// full frame to c.zoom, moving the view in the direction of c.pan
+func (c *converter) zoompanFilter() string {
+	frames := int(c.stillDuration.Seconds() * stillFrameRate)
+	if frames < 2 {
+		frames = 2
+	}
+	// Zoom progresses linearly over the output frames
+	zoom := fmt.Sprintf("1+%g*on/%d", c.zoom-1, frames-1)
+	progress := fmt.Sprintf("on/%d", frames-1)
+
+	x := "(iw-iw/zoom)/2"
+	y := "(ih-ih/zoom)/2"
+	switch c.pan {
+	case "left":
+		x = "(iw-iw/zoom)*(1-" + progress + ")"
+	case "right":
+		x = "(iw-iw/zoom)*" + progress
+	case "up":
+		y = "(ih-ih/zoom)*(1-" + progress + ")"
+	case "down":
+		y = "(ih-ih/zoom)*" + progress
+	}
+
+	filter := fmt.Sprintf("zoompan=z='%s':x='%s':y='%s':d=%d:fps=%d", zoom, x, y, frames, stillFrameRate)
+
+	// zoompan renders at 1280x720 unless told otherwise
+	width, height := c.displaySize()
+	if width > 0 && height > 0 {
+		filter += fmt.Sprintf(":s=%dx%d", width, height)
+	}
+
+	return filter
+}
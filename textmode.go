@@ -0,0 +1,25 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// textScale returns the scaling filter of -text-mode. Outputs at least as
+// large as the source keep hard pixel edges, smaller ones are downscaled with
+// lanczos and sharpened so thin glyph strokes survive.
+func (c *converter) textScale(width, height string) string {
+	sourceWidth, _ := c.displaySize()
+	if w, err := strconv.Atoi(width); err == nil && sourceWidth > 0 && w >= sourceWidth {
+		return "scale=" + width + ":" + height + ":flags=neighbor"
+	}
+
+	return "scale=" + width + ":" + height + ":flags=lanczos,unsharp=3:3:0.8:3:3:0"
+}
+
+// textPaletteFilter maps the output to a palette of the colors that change
+// between frames, without dithering, which would speckle the flat
+// backgrounds around text
+func textPaletteFilter(suffix string) string {
+	return fmt.Sprintf("split[pa%[1]s][pb%[1]s];[pa%[1]s]palettegen=stats_mode=diff[pp%[1]s];[pb%[1]s][pp%[1]s]paletteuse=dither=none:diff_mode=rectangle", suffix)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// stageTimings is the wall-clock time a job spent in each stage. Outputs
+// that are retuned to fit a size limit count their optimization as
+// conversion.
+type stageTimings struct {
+	Fetch    time.Duration
+	Convert  time.Duration
+	Optimize time.Duration
+	Upload   time.Duration
+}
+
+type stageSeconds struct {
+	Fetch    float64 `json:"fetch"`
+	Convert  float64 `json:"convert"`
+	Optimize float64 `json:"optimize"`
+	Upload   float64 `json:"upload"`
+}
+
+func (t stageTimings) seconds() *stageSeconds {
+	return &stageSeconds{t.Fetch.Seconds(), t.Convert.Seconds(), t.Optimize.Seconds(), t.Upload.Seconds()}
+}
+
+// timed adds the time until the returned function is called to d
+func timed(d *time.Duration) func() {
+	start := time.Now()
+	return func() {
+		*d += time.Since(start)
+	}
+}
+
+// printTimings writes the total and average time of each stage over the
+// jobs to stderr
+func printTimings(jobs []*converter) {
+	if len(jobs) == 0 {
+		return
+	}
+
+	var total stageTimings
+	for _, c := range jobs {
+		total.Fetch += c.timings.Fetch
+		total.Convert += c.timings.Convert
+		total.Optimize += c.timings.Optimize
+		total.Upload += c.timings.Upload
+	}
+
+	n := time.Duration(len(jobs))
+	round := func(d time.Duration) time.Duration {
+		return d.Round(10 * time.Millisecond)
+	}
+	progressLine.println(os.Stderr, fmt.Sprintf("%-9s %10s %10s", "stage", "total", "average"))
+	for _, s := range []struct {
+		name string
+		d    time.Duration
+	}{
+		{"fetch", total.Fetch},
+		{"convert", total.Convert},
+		{"optimize", total.Optimize},
+		{"upload", total.Upload},
+	} {
+		progressLine.println(os.Stderr, fmt.Sprintf("%-9s %10s %10s", s.name, round(s.d), round(s.d/n)))
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/debug"
+)
+
+// Build information is set by the Makefile with -ldflags, e.g.
+// -X main.version=v1.2.3. Builds without it fall back to the VCS details Go
+// embeds in the binary.
+var (
+	version   = "dev"
+	commit    = ""
+	buildDate = ""
+)
+
+// ffmpegRequirement is the oldest ffmpeg with every filter in use
+const ffmpegRequirement = "ffmpeg 4.3 or later, with libzimg for HDR tone mapping"
+
+type buildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	BuildDate string `json:"build_date,omitempty"`
+	GoVersion string `json:"go_version"`
+	Platform  string `json:"platform"`
+	Requires  string `json:"requires"`
+}
+
+func currentBuild() buildInfo {
+	info := buildInfo{
+		Version:   version,
+		Commit:    commit,
+		BuildDate: buildDate,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+		Requires:  ffmpegRequirement,
+	}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range bi.Settings {
+			switch {
+			case s.Key == "vcs.revision" && info.Commit == "":
+				info.Commit = s.Value
+			case s.Key == "vcs.time" && info.BuildDate == "":
+				info.BuildDate = s.Value
+			}
+		}
+	}
+
+	return info
+}
+
+// userAgent identifies the build in requests to release servers
+func userAgent() string {
+	return releaseBinaryName + "/" + version
+}
+
+// versionCommand prints the build information, as JSON with --json
+func versionCommand(args []string) error {
+	info := currentBuild()
+	switch {
+	case len(args) == 0:
+		fmt.Println(releaseBinaryName, info.Version)
+		if info.Commit != "" {
+			fmt.Println("commit:  ", info.Commit)
+		}
+		if info.BuildDate != "" {
+			fmt.Println("built:   ", info.BuildDate)
+		}
+		fmt.Println("go:      ", info.GoVersion, info.Platform)
+		fmt.Println("requires:", info.Requires)
+		return nil
+	case len(args) == 1 && (args[0] == "--json" || args[0] == "-json"):
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(info)
+	}
+
+	return errors.New("Usage: go-gif-pr version [--json]")
+}
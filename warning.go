@@ -0,0 +1,44 @@
+package main
+
+import (
+	"strings"
+)
+
+// warning is a non-fatal problem of a job, printed as it happens and listed
+// in the JSON output and reports. Code identifies the kind of problem for
+// tools reading them.
+type warning struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Codes of the warnings
+const (
+	warnUploadLimit   = "upload-limit"
+	warnNoClientID    = "no-client-id"
+	warnImgurDuration = "imgur-duration"
+	warnImgurAudio    = "imgur-audio"
+	warnImgurCredits  = "imgur-credits"
+	warnSharedPalette = "shared-palette"
+	warnNoVidstab     = "no-vidstab"
+	warnNotOptimized  = "not-optimized"
+	warnMirrorTitle   = "mirror-title"
+	warnDecoder       = "decoder-fallback"
+)
+
+// warn prints a warning and records it with the job
+func (c *converter) warn(code string, err error) {
+	printError(err)
+	// Variants start from a copy of the job's warnings, so never append
+	// into an array they may share
+	c.warnings = append(c.warnings[:len(c.warnings):len(c.warnings)], warning{Code: code, Message: err.Error()})
+}
+
+func warningMessages(warnings []warning) string {
+	var messages []string
+	for _, w := range warnings {
+		messages = append(messages, w.Message)
+	}
+
+	return strings.Join(messages, "; ")
+}
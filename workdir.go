@@ -0,0 +1,36 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// workPath places a downloaded, intermediary or output file in -work-dir,
+// or the current directory when it is not set
+func (c *converter) workPath(name string) string {
+	if c.workDir == "" {
+		return name
+	}
+
+	return filepath.Join(c.workDir, name)
+}
+
+func (c *converter) createWorkDir() error {
+	if c.workDir == "" {
+		return nil
+	}
+
+	return os.MkdirAll(c.workDir, 0755)
+}
+
+// filterPath quotes a file path for use as a filter option, where colons
+// such as the one of a Windows drive would end the option
+func filterPath(p string) string {
+	if !strings.ContainsAny(p, `:\' ,;[]`) {
+		return p
+	}
+
+	p = strings.ReplaceAll(filepath.ToSlash(p), "'", `'\''`)
+	return "'" + strings.ReplaceAll(p, ":", `\:`) + "'"
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Each job keeps its downloaded source and intermediary files in its own
+// directory under -work-dir, next to a manifest describing the job. The
+// workspaces of crashed runs are found by their manifests on the next start.
+const (
+	workspacesDirName = ".gifv-jobs"
+	jobManifestName   = "job.json"
+)
+
+// jobManifest records what a job was converting, and by which process
+type jobManifest struct {
+	PID      int       `json:"pid"`
+	Started  time.Time `json:"started"`
+	Source   string    `json:"source"`
+	Trim     string    `json:"trim,omitempty"`
+	Width    string    `json:"width,omitempty"`
+	Caption  string    `json:"caption,omitempty"`
+	Alt      string    `json:"alt,omitempty"`
+	Uploader string    `json:"uploader,omitempty"`
+	// Fetched is the downloaded source, once the download completed
+	Fetched string `json:"fetched,omitempty"`
+	// Done marks workspaces left behind on purpose by -k
+	Done bool `json:"done,omitempty"`
+}
+
+// openWorkspace creates the job's workspace, or takes over the one of a
+// resumed job. Only jobs downloading, capturing or copying their source
+// have one, the intermediary files of local sources go to -work-dir.
+func (c *converter) openWorkspace() error {
+	if c.workspace == "" {
+		name := fmt.Sprintf("%s-%d-%d", time.Now().Format("20060102-150405"), os.Getpid(), c.index+1)
+		c.workspace = c.workPath(filepath.Join(workspacesDirName, name))
+		err := os.MkdirAll(c.workspace, 0700)
+		if err != nil {
+			return err
+		}
+	}
+
+	return c.saveWorkspace(false)
+}
+
+// tempPath places an intermediary file in the job's workspace
+func (c *converter) tempPath(name string) string {
+	if c.workspace == "" {
+		return c.workPath(name)
+	}
+
+	return filepath.Join(c.workspace, name)
+}
+
+func (c *converter) saveWorkspace(done bool) error {
+	if c.workspace == "" {
+		return nil
+	}
+
+	m := jobManifest{
+		PID:      os.Getpid(),
+		Started:  time.Now().UTC().Truncate(time.Second),
+		Source:   c.startImage,
+		Trim:     c.trim,
+		Width:    c.imageWidth,
+		Caption:  c.caption,
+		Alt:      c.alt,
+		Uploader: c.uploader,
+		Done:     done,
+	}
+	if c.fileToConvert != "" && c.fileToConvert != c.startImage {
+		m.Fetched = c.fileToConvert
+	}
+
+	return writeJSON(filepath.Join(c.workspace, jobManifestName), m)
+}
+
+// removeWorkspace removes the workspace with everything in it. A source
+// kept by -keep-source is moved out first.
+func (c *converter) removeWorkspace() {
+	if c.workspace == "" {
+		return
+	}
+	if c.keepSource && c.fileToConvert != c.startImage && fileSize(c.fileToConvert) > 0 {
+		kept := c.workPath(filepath.Base(c.fileToConvert))
+		if err := os.Rename(c.fileToConvert, kept); err != nil {
+			printError(err)
+			return
+		}
+		c.fileToConvert = kept
+	}
+
+	err := os.RemoveAll(c.workspace)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, fmt.Sprintf(tr("Could not remove file: %s"), c.workspace))
+		return
+	}
+	// The root goes with the last workspace, os.Remove leaves it while
+	// other jobs or runs still have theirs
+	os.Remove(filepath.Dir(c.workspace))
+}
+
+type orphanedWorkspace struct {
+	dir      string
+	manifest jobManifest
+}
+
+// findOrphans returns the workspaces under workDir whose process is gone
+// before their job finished
+func findOrphans(workDir string) ([]orphanedWorkspace, error) {
+	root := filepath.Join(workDir, workspacesDirName)
+	entries, err := os.ReadDir(root)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var orphans []orphanedWorkspace
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		dir := filepath.Join(root, entry.Name())
+		data, err := os.ReadFile(filepath.Join(dir, jobManifestName))
+		if err != nil {
+			continue
+		}
+		var m jobManifest
+		if json.Unmarshal(data, &m) != nil || m.Done || processAlive(m.PID) {
+			continue
+		}
+		orphans = append(orphans, orphanedWorkspace{dir: dir, manifest: m})
+	}
+
+	return orphans, nil
+}
+
+// recoverWorkspaces handles the workspaces of crashed runs as -recover says:
+// resume converts their sources again without downloading them, retry
+// starts their jobs over and clean removes them. Without -recover they are
+// only reported. The returned jobs run ahead of the new inputs.
+func recoverWorkspaces(defaults *converter) ([]*converter, error) {
+	orphans, err := findOrphans(defaults.workDir)
+	if err != nil || len(orphans) == 0 {
+		return nil, err
+	}
+
+	if defaults.recoverMode == "" {
+		printError(fmt.Errorf(tr("Found %d workspaces of crashed runs in %s; use -recover resume, retry or clean"),
+			len(orphans), filepath.Join(defaults.workDir, workspacesDirName)))
+		return nil, nil
+	}
+
+	var jobs []*converter
+	for _, orphan := range orphans {
+		m := orphan.manifest
+		if defaults.recoverMode == "clean" {
+			stage("recover", fmt.Sprintf(tr("removed the workspace of %s"), m.Source))
+			os.RemoveAll(orphan.dir)
+			continue
+		}
+
+		job := *defaults
+		job.startImage, job.trim, job.caption, job.alt = m.Source, m.Trim, m.Caption, m.Alt
+		if m.Width != "" {
+			job.imageWidth, job.widthList = m.Width, ""
+		}
+		if m.Uploader != "" {
+			job.uploader = m.Uploader
+		}
+		if defaults.recoverMode == "resume" && m.Fetched != "" && fileSize(m.Fetched) > 0 {
+			job.workspace = orphan.dir
+			job.resumed = m.Fetched
+		} else {
+			os.RemoveAll(orphan.dir)
+		}
+		err = job.validate()
+		if err != nil {
+			return nil, errors.New(m.Source + ": " + err.Error())
+		}
+		stage("recover", defaults.recoverMode+" "+m.Source)
+		jobs = append(jobs, &job)
+	}
+	// Left empty when every workspace was cleaned or started over
+	os.Remove(filepath.Join(defaults.workDir, workspacesDirName))
+
+	return jobs, nil
+}
+
+func (c *converter) validateRecover() error {
+	switch c.recoverMode {
+	case "", "resume", "retry", "clean":
+	default:
+		return errors.New("-recover must be resume, retry or clean")
+	}
+
+	return nil
+}